@@ -0,0 +1,275 @@
+package afs
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// ChangeType tells how a node differs between two afs trees
+type ChangeType int
+
+const (
+	Added    ChangeType = iota // only in new tree
+	Removed                    // only in old tree
+	Modified                   // same path, different digest
+	Renamed                    // same content, different path
+)
+
+var changeTypes = []string{"added", "removed", "modified", "renamed"}
+
+func (t ChangeType) String() string {
+	if t < 0 || int(t) >= len(changeTypes) {
+		return fmt.Sprintf("ChangeType(%d)", int(t))
+	}
+	return changeTypes[t]
+}
+
+// MarshalText makes ChangeType serialized as its name
+func (t ChangeType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText parses name of ChangeType
+func (t *ChangeType) UnmarshalText(text []byte) error {
+	for k, v := range changeTypes {
+		if v == string(text) {
+			*t = ChangeType(k)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown change type %q", text)
+}
+
+// Change is a file or directory differs between two afs trees
+//
+// Changes of directories are reported along with changes of files inside
+// them, except renamed ones.
+type Change struct {
+	Type      ChangeType
+	Path      string // path in new tree, or in old tree if removed
+	OldPath   string // path in old tree, empty if added or removed
+	Dir       bool
+	OldDigest []byte // nil if added
+	NewDigest []byte // nil if removed
+	OldSize   uint64 // always 0 for directories
+	NewSize   uint64
+}
+
+// Diff compares two afs trees, changes are sorted by Path
+//
+// Subtrees with same digest and names are skipped. Files or directories
+// which are removed from one place and added to another place with same
+// content are reported as renamed, empty ones excepted, as they are not
+// distinguishable. Lazily loaded trees are loaded fully.
+func Diff(old, new *Directory) (ret []Change, err error) {
+	if err = old.LoadAll(); err != nil {
+		return
+	}
+	if err = new.LoadAll(); err != nil {
+		return
+	}
+
+	x := &differ{moved: map[*File]bool{}}
+	x.dir(old, new)
+	x.renameDirs()
+	x.renameFiles()
+
+	ret = x.changes
+	for _, d := range x.removedDirs {
+		if !x.movedDirs[d] {
+			ret = append(ret, Change{Type: Removed, Path: d.Path, Dir: true, OldDigest: d.Digest()})
+		}
+	}
+	for _, d := range x.addedDirs {
+		if !x.movedDirs[d] {
+			ret = append(ret, Change{Type: Added, Path: d.Path, Dir: true, NewDigest: d.Digest()})
+		}
+	}
+	for _, f := range x.removed {
+		if !x.moved[f] {
+			ret = append(ret, Change{Type: Removed, Path: f.Path, OldDigest: f.Digest, OldSize: f.Size})
+		}
+	}
+	for _, f := range x.added {
+		if !x.moved[f] {
+			ret = append(ret, Change{Type: Added, Path: f.Path, NewDigest: f.Digest, NewSize: f.Size})
+		}
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool { return ret[i].Path < ret[j].Path })
+	return
+}
+
+// differ holds states needed when comparing afs trees
+type differ struct {
+	changes     []Change
+	added       []*File      // files only in new tree
+	removed     []*File      // files only in old tree
+	addedDirs   []*Directory // directories only in new tree, subfolders excluded
+	removedDirs []*Directory // directories only in old tree, subfolders excluded
+	moved       map[*File]bool
+	movedDirs   map[*Directory]bool
+}
+
+func (x *differ) dir(a, b *Directory) {
+	if bytes.Equal(a.Digest(), b.Digest()) && sameNames(a, b) {
+		return
+	}
+
+	i, j := 0, 0
+	for i < len(a.Files) || j < len(b.Files) {
+		switch {
+		case j >= len(b.Files) || (i < len(a.Files) && a.Files[i].Name < b.Files[j].Name):
+			x.removed = append(x.removed, a.Files[i])
+			i++
+		case i >= len(a.Files) || a.Files[i].Name > b.Files[j].Name:
+			x.added = append(x.added, b.Files[j])
+			j++
+		default:
+			if fa, fb := a.Files[i], b.Files[j]; !bytes.Equal(fa.Digest, fb.Digest) {
+				x.changes = append(x.changes, Change{
+					Type:      Modified,
+					Path:      fb.Path,
+					OldPath:   fa.Path,
+					OldDigest: fa.Digest,
+					NewDigest: fb.Digest,
+					OldSize:   fa.Size,
+					NewSize:   fb.Size,
+				})
+			}
+			i++
+			j++
+		}
+	}
+
+	i, j = 0, 0
+	for i < len(a.Subfolders) || j < len(b.Subfolders) {
+		switch {
+		case j >= len(b.Subfolders) || (i < len(a.Subfolders) && a.Subfolders[i].Name < b.Subfolders[j].Name):
+			x.removedDirs = append(x.removedDirs, a.Subfolders[i])
+			x.removed = files(a.Subfolders[i], x.removed)
+			i++
+		case i >= len(a.Subfolders) || a.Subfolders[i].Name > b.Subfolders[j].Name:
+			x.addedDirs = append(x.addedDirs, b.Subfolders[j])
+			x.added = files(b.Subfolders[j], x.added)
+			j++
+		default:
+			x.dir(a.Subfolders[i], b.Subfolders[j])
+			i++
+			j++
+		}
+	}
+}
+
+// renameDirs pairs removed and added directories with same content
+func (x *differ) renameDirs() {
+	x.movedDirs = map[*Directory]bool{}
+	for _, b := range x.addedDirs {
+		if empty(b) {
+			continue
+		}
+		for _, a := range x.removedDirs {
+			if x.movedDirs[a] || !bytes.Equal(a.Digest(), b.Digest()) || !sameNames(a, b) {
+				continue
+			}
+			x.movedDirs[a] = true
+			x.movedDirs[b] = true
+			for _, f := range files(a, nil) {
+				x.moved[f] = true
+			}
+			for _, f := range files(b, nil) {
+				x.moved[f] = true
+			}
+			x.changes = append(x.changes, Change{
+				Type:      Renamed,
+				Path:      b.Path,
+				OldPath:   a.Path,
+				Dir:       true,
+				OldDigest: a.Digest(),
+				NewDigest: b.Digest(),
+			})
+			break
+		}
+	}
+}
+
+// renameFiles pairs removed and added files with same content, files with
+// same name are preferred
+func (x *differ) renameFiles() {
+	byDigest := map[string][]*File{}
+	for _, f := range x.removed {
+		if !x.moved[f] && f.Size > 0 {
+			byDigest[string(f.Digest)] = append(byDigest[string(f.Digest)], f)
+		}
+	}
+
+	for _, b := range x.added {
+		if x.moved[b] || b.Size == 0 {
+			continue
+		}
+		var match *File
+		for _, a := range byDigest[string(b.Digest)] {
+			if x.moved[a] || a.Size != b.Size {
+				continue
+			}
+			if match == nil || (a.Name == b.Name && match.Name != b.Name) {
+				match = a
+			}
+		}
+		if match == nil {
+			continue
+		}
+		x.moved[match] = true
+		x.moved[b] = true
+		x.changes = append(x.changes, Change{
+			Type:      Renamed,
+			Path:      b.Path,
+			OldPath:   match.Path,
+			OldDigest: match.Digest,
+			NewDigest: b.Digest,
+			OldSize:   match.Size,
+			NewSize:   b.Size,
+		})
+	}
+}
+
+// sameNames reports whether a and b have same names recursively
+func sameNames(a, b *Directory) bool {
+	if len(a.Files) != len(b.Files) || len(a.Subfolders) != len(b.Subfolders) {
+		return false
+	}
+	for k, f := range a.Files {
+		if f.Name != b.Files[k].Name {
+			return false
+		}
+	}
+	for k, sub := range a.Subfolders {
+		if sub.Name != b.Subfolders[k].Name || !sameNames(sub, b.Subfolders[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// files appends all files inside d to ret
+func files(d *Directory, ret []*File) []*File {
+	ret = append(ret, d.Files...)
+	for _, sub := range d.Subfolders {
+		ret = files(sub, ret)
+	}
+	return ret
+}
+
+// empty reports whether d has no file recursively
+func empty(d *Directory) bool {
+	if len(d.Files) > 0 {
+		return false
+	}
+	for _, sub := range d.Subfolders {
+		if !empty(sub) {
+			return false
+		}
+	}
+	return true
+}
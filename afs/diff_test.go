@@ -0,0 +1,102 @@
+package afs_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+)
+
+// summary formats changes as "type path" or "type path<oldpath", one per line
+func summary(changes []afs.Change) string {
+	ret := make([]string, len(changes))
+	for k, c := range changes {
+		ret[k] = c.Type.String() + " " + c.Path
+		if c.Type == afs.Renamed {
+			ret[k] += "<" + c.OldPath
+		}
+	}
+	return strings.Join(ret, "\n")
+}
+
+func diff(t *testing.T, old, new map[string]string) string {
+	changes, err := afs.Diff(newTree(t, old), newTree(t, new))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return summary(changes)
+}
+
+func TestDiffModified(t *testing.T) {
+	old := newTree(t, map[string]string{"Data/x.dat": "x", "Data/y.dat": "y", "a.txt": "a"})
+	new := newTree(t, map[string]string{"Data/x.dat": "xx", "Data/y.dat": "y", "a.txt": "a"})
+	changes, err := afs.Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 {
+		t.Fatalf("expected 1 change, got\n%s", summary(changes))
+	}
+	c := changes[0]
+	if c.Type != afs.Modified || c.Path != "/Data/x.dat" || c.OldPath != "/Data/x.dat" || c.OldSize != 1 || c.NewSize != 2 {
+		t.Errorf("unexpected change %+v", c)
+	}
+}
+
+func TestDiffPrune(t *testing.T) {
+	files := map[string]string{"Data/x.dat": "x", "Data/y.dat": "y", "a.txt": "a"}
+	old, new := newTree(t, files), newTree(t, files)
+
+	// digest of /Data/ is cached, so changing file digest behind its back is
+	// not seen if the subtree is skipped
+	new.Digest()
+	f, err := new.LookupFile("Data/x.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Digest = []byte("forged")
+
+	changes, err := afs.Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("unchanged subtree is compared:\n%s", summary(changes))
+	}
+}
+
+func TestDiffRenameFile(t *testing.T) {
+	got := diff(t,
+		map[string]string{"a.dat": "same", "x.dat": "same", "k.txt": "k"},
+		map[string]string{"Data/x.dat": "same", "Data/n.txt": "n", "k.txt": "k"},
+	)
+	want := strings.Join([]string{
+		"added /Data/",
+		"added /Data/n.txt",
+		"renamed /Data/x.dat</x.dat",
+		"removed /a.dat",
+	}, "\n")
+	if got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestDiffRenameDir(t *testing.T) {
+	got := diff(t,
+		map[string]string{"Art/a.dds": "a", "Art/Sub/b.dds": "b", "k.txt": "k"},
+		map[string]string{"Art2/a.dds": "a", "Art2/Sub/b.dds": "b", "k.txt": "k"},
+	)
+	if want := "renamed /Art2/</Art/"; got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestDiffEmptyFiles(t *testing.T) {
+	got := diff(t,
+		map[string]string{"e1.txt": "", "k.txt": "k"},
+		map[string]string{"e2.txt": "", "k.txt": "k"},
+	)
+	if want := "removed /e1.txt\nadded /e2.txt"; got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
@@ -0,0 +1,77 @@
+package afs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"sort"
+)
+
+// DigestIndex maps file digests to files having that content
+type DigestIndex map[string][]*File
+
+// NewDigestIndex indexes every file in d recursively, lazily loaded trees are loaded fully
+func NewDigestIndex(d *Directory) (ret DigestIndex, err error) {
+	if err = d.LoadAll(); err != nil {
+		return
+	}
+	ret = DigestIndex{}
+	for _, f := range files(d, nil) {
+		ret.Add(f)
+	}
+	return
+}
+
+// Add indexes f
+func (x DigestIndex) Add(f *File) {
+	key := hex.EncodeToString(f.Digest)
+	x[key] = append(x[key], f)
+}
+
+// Find returns files with digest, nil if not found
+func (x DigestIndex) Find(digest []byte) []*File {
+	return x[hex.EncodeToString(digest)]
+}
+
+// FindContent returns files having same content as r
+func (x DigestIndex) FindContent(r io.Reader) ([]*File, error) {
+	sum := sha256.New()
+	if _, err := io.Copy(sum, r); err != nil {
+		return nil, err
+	}
+	return x.Find(sum.Sum(nil)), nil
+}
+
+// Duplicate is a group of files with same content
+type Duplicate struct {
+	Digest []byte
+	Size   uint64  // size of one file
+	Files  []*File // sorted by Path
+}
+
+// Wasted returns bytes can be saved by keeping only one copy
+func (d Duplicate) Wasted() uint64 {
+	return d.Size * uint64(len(d.Files)-1)
+}
+
+// Duplicates returns groups of files with same content, most wasteful group first
+//
+// Empty files are not considered duplicated.
+func (x DigestIndex) Duplicates() (ret []Duplicate) {
+	for _, same := range x {
+		if len(same) < 2 || same[0].Size == 0 {
+			continue
+		}
+		group := append([]*File{}, same...)
+		sort.Slice(group, func(i, j int) bool { return group[i].Path < group[j].Path })
+		ret = append(ret, Duplicate{Digest: group[0].Digest, Size: group[0].Size, Files: group})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if a, b := ret[i].Wasted(), ret[j].Wasted(); a != b {
+			return a > b
+		}
+		return ret[i].Files[0].Path < ret[j].Files[0].Path
+	})
+	return
+}
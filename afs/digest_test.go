@@ -0,0 +1,91 @@
+package afs_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+var dupTree = map[string]string{
+	"a.txt":          "short",
+	"Data/a.txt":     "short",
+	"Data/big.dat":   "0123456789",
+	"Art/big.dat":    "0123456789",
+	"Art/copy.dat":   "0123456789",
+	"Art/unique.dds": "unique",
+	"e1.txt":         "",
+	"Data/e2.txt":    "",
+}
+
+// filePaths joins paths of files with comma
+func filePaths(files []*afs.File) string {
+	ret := make([]string, len(files))
+	for k, f := range files {
+		ret[k] = f.Path
+	}
+	return strings.Join(ret, ",")
+}
+
+func TestDigestIndex(t *testing.T) {
+	lazy, err := afs.FromGGPKLazy(bytes.NewReader(pack(t, newTree(t, dupTree), record.Version3)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, root := range map[string]*afs.Directory{"new": newTree(t, dupTree), "lazy": lazy} {
+		x, err := afs.NewDigestIndex(root)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		sum := sha256.Sum256([]byte("unique"))
+		if got := filePaths(x.Find(sum[:])); got != "/Art/unique.dds" {
+			t.Errorf("%s: Find returns %s", name, got)
+		}
+		found, err := x.FindContent(strings.NewReader("short"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(found) != 2 {
+			t.Errorf("%s: FindContent returns %s", name, filePaths(found))
+		}
+		if found, _ = x.FindContent(strings.NewReader("missing")); found != nil {
+			t.Errorf("%s: FindContent returns %s for missing content", name, filePaths(found))
+		}
+
+		// empty files are not duplicated, wasteful groups first
+		dups := x.Duplicates()
+		if len(dups) != 2 {
+			t.Fatalf("%s: expected 2 groups, got %d", name, len(dups))
+		}
+		if got := filePaths(dups[0].Files); got != "/Art/big.dat,/Art/copy.dat,/Data/big.dat" {
+			t.Errorf("%s: first group is %s", name, got)
+		}
+		if got := filePaths(dups[1].Files); got != "/Data/a.txt,/a.txt" {
+			t.Errorf("%s: second group is %s", name, got)
+		}
+		if w := dups[0].Wasted(); w != 20 {
+			t.Errorf("%s: expected 20 bytes wasted, got %d", name, w)
+		}
+		if w := dups[1].Wasted(); w != 5 {
+			t.Errorf("%s: expected 5 bytes wasted, got %d", name, w)
+		}
+	}
+}
+
+func TestDuplicatesTie(t *testing.T) {
+	x, err := afs.NewDigestIndex(newTree(t, map[string]string{
+		"b1": "bb", "b2": "bb",
+		"a1": "aa", "a2": "aa",
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dups := x.Duplicates()
+	if len(dups) != 2 || dups[0].Files[0].Path != "/a1" || dups[1].Files[0].Path != "/b1" {
+		t.Errorf("groups wasting same bytes are not sorted by path: %v", dups)
+	}
+}
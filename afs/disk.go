@@ -0,0 +1,192 @@
+package afs
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// Symlinks decides what FromDirectory does with symbolic links
+type Symlinks int
+
+const (
+	Reject Symlinks = iota // fail with an error
+	Follow                 // treat as the file or directory linked to
+)
+
+var (
+	errSymlink    = errors.New("symbolic link is not allowed")
+	errSymlinkDir = errors.New("symbolic link loops to its parent directory")
+	errIrregular  = errors.New("not a regular file or directory")
+)
+
+// diskFile is path of a physic file, which is opened only when reading
+//
+// ReadAt opens the file on every call, use File.Open to read it efficiently.
+type diskFile string
+
+func (p diskFile) ReadAt(b []byte, off int64) (n int, err error) {
+	f, err := os.Open(string(p))
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	return f.ReadAt(b, off)
+}
+
+// FromDirectory builds afs structure from physic directory at path recursively
+//
+// Files are hashed concurrently, and are not kept opened, so huge directories
+// can be loaded without running out of file descriptors. A file is opened
+// again by File.Open when reading its content. Files other than regular files
+// and directories are rejected.
+func FromDirectory(path string, links Symlinks) (root *Directory, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	if !info.IsDir() {
+		return nil, &fs.PathError{Op: "open", Path: path, Err: errNotDir}
+	}
+
+	root = Root()
+	root.Path = "/"
+	root.Timestamp = uint32(info.ModTime().Unix())
+
+	s := &scanner{links: links}
+	if err = s.dir(path, root, []os.FileInfo{info}); err != nil {
+		return nil, err
+	}
+	if err = s.hash(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// scanner holds states needed when building afs from physic directory
+type scanner struct {
+	links Symlinks
+	files []*File // files to be hashed
+}
+
+// dir adds content of physic directory path to cur, parents are used to detect loop
+func (s *scanner) dir(path string, cur *Directory, parents []os.FileInfo) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		fn := filepath.Join(path, e.Name())
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			if s.links == Reject {
+				return &fs.PathError{Op: "open", Path: fn, Err: errSymlink}
+			}
+			if info, err = os.Stat(fn); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case info.IsDir():
+			for _, p := range parents {
+				if os.SameFile(p, info) {
+					return &fs.PathError{Op: "open", Path: fn, Err: errSymlinkDir}
+				}
+			}
+			sub := Root()
+			sub.Path = cur.Path + e.Name() + "/"
+			sub.Name = e.Name()
+			sub.Hash = cur.version.Hash(sub.Name)
+			sub.Timestamp = uint32(info.ModTime().Unix())
+			sub.parent = cur
+			cur.Subfolders = append(cur.Subfolders, sub)
+			if err = s.dir(fn, sub, append(parents, info)); err != nil {
+				return err
+			}
+		case info.Mode().IsRegular():
+			f := &File{
+				Path:      cur.Path + e.Name(),
+				Name:      e.Name(),
+				Timestamp: uint32(info.ModTime().Unix()),
+				Hash:      cur.version.Hash(e.Name()),
+				Size:      uint64(info.Size()),
+				OrigFile:  diskFile(fn),
+			}
+			cur.Files = append(cur.Files, f)
+			s.files = append(s.files, f)
+		default:
+			return &fs.PathError{Op: "open", Path: fn, Err: errIrregular}
+		}
+	}
+
+	sort.Sort(ByName(cur.Files))
+	sort.Sort(ByPath(cur.Subfolders))
+	return nil
+}
+
+// hash computes digest of all files found, using one goroutine per cpu
+func (s *scanner) hash() (err error) {
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		ch   = make(chan *File)
+		quit = make(chan struct{})
+	)
+	fail := func(e error) {
+		once.Do(func() {
+			err = e
+			close(quit)
+		})
+	}
+
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range ch {
+				if e := digest(f); e != nil {
+					fail(e)
+				}
+			}
+		}()
+	}
+
+feed:
+	for _, f := range s.files {
+		select {
+		case ch <- f:
+		case <-quit:
+			break feed
+		}
+	}
+	close(ch)
+	wg.Wait()
+	return
+}
+
+// digest computes f.Digest from its content
+func digest(f *File) error {
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	sum := sha256.New()
+	if _, err = io.Copy(sum, r); err != nil {
+		return err
+	}
+	f.Digest = sum.Sum(nil)
+	return nil
+}
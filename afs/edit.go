@@ -0,0 +1,227 @@
+package afs
+
+import (
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Methods in this file edit afs tree in place. They keep Files and Subfolders
+// sorted, maintain Path and Hash of affected nodes, and invalidate cached digests of
+// the directory and its ancestors, so the tree can be passed to
+// generate.FromAFS after editing. Lazily loaded directories are loaded
+// first. They are not safe for concurrent use.
+
+// errMoveIntoSelf reports moving a directory into itself or its subfolders
+var errMoveIntoSelf = errors.New("cannot move directory into itself")
+
+// Parent returns directory containing d, nil for root
+func (d *Directory) Parent() *Directory {
+	return d.parent
+}
+
+// AddFile adds f to d, f.Path is updated
+//
+// It fails if d already has a file or subfolder named f.Name.
+func (d *Directory) AddFile(f *File) error {
+	if err := d.prepare("add", f.Name); err != nil {
+		return err
+	}
+	f.Path = d.Path + f.Name
+	f.Hash = d.version.Hash(f.Name)
+	f.entry = 0
+	d.insertFile(f)
+	d.invalidate()
+	return nil
+}
+
+// Mkdir creates an empty subfolder in d
+//
+// It fails if d already has a file or subfolder named name.
+func (d *Directory) Mkdir(name string) (ret *Directory, err error) {
+	if err = d.prepare("mkdir", name); err != nil {
+		return
+	}
+	ret = Root()
+	ret.version = d.version
+	ret.Name = name
+	ret.Hash = d.version.Hash(name)
+	ret.Path = d.Path + name + "/"
+	ret.Timestamp = uint32(time.Now().Unix())
+	d.insertDir(ret)
+	d.invalidate()
+	return
+}
+
+// Remove removes file or subfolder, with its content, named name from d
+func (d *Directory) Remove(name string) error {
+	if err := d.Load(); err != nil {
+		return err
+	}
+	if idx, ok := d.fileIndex(name); ok {
+		d.Files = append(d.Files[:idx], d.Files[idx+1:]...)
+	} else if idx, ok := d.dirIndex(name); ok {
+		d.Subfolders[idx].parent = nil
+		d.Subfolders = append(d.Subfolders[:idx], d.Subfolders[idx+1:]...)
+	} else {
+		return &NotFoundError{Path: d.Path + name, Dir: d.Path, Name: name}
+	}
+	d.invalidate()
+	return nil
+}
+
+// Replace replaces file in d named f.Name with f, f.Path is updated
+//
+// Use it to change content of a file.
+func (d *Directory) Replace(f *File) error {
+	if err := d.Load(); err != nil {
+		return err
+	}
+	idx, ok := d.fileIndex(f.Name)
+	if !ok {
+		if _, isDir := d.dirIndex(f.Name); isDir {
+			return &fs.PathError{Op: "replace", Path: d.Path + f.Name, Err: errIsDir}
+		}
+		return &NotFoundError{Path: d.Path + f.Name, Dir: d.Path, Name: f.Name}
+	}
+	f.Path = d.Path + f.Name
+	f.Hash = d.version.Hash(f.Name)
+	f.entry = d.Files[idx].entry
+	d.Files[idx] = f
+	d.invalidate()
+	return nil
+}
+
+// Rename moves file or subfolder named name from d to dest, as newName
+//
+// dest can be d itself. It fails if dest already has a file or subfolder
+// named newName, or dest is the directory being moved or inside it.
+func (d *Directory) Rename(name string, dest *Directory, newName string) error {
+	if err := d.Load(); err != nil {
+		return err
+	}
+	if dest == d && name == newName {
+		if _, ok := d.fileIndex(name); ok {
+			return nil
+		}
+		if _, ok := d.dirIndex(name); ok {
+			return nil
+		}
+	}
+	if err := dest.prepare("rename", newName); err != nil {
+		return err
+	}
+
+	if idx, ok := d.fileIndex(name); ok {
+		f := d.Files[idx]
+		d.Files = append(d.Files[:idx], d.Files[idx+1:]...)
+		f.Name = newName
+		f.Hash = dest.version.Hash(newName)
+		f.Path = dest.Path + newName
+		if dest != d {
+			f.entry = 0
+		}
+		dest.insertFile(f)
+		d.invalidate()
+		dest.invalidate()
+		return nil
+	}
+
+	idx, ok := d.dirIndex(name)
+	if !ok {
+		return &NotFoundError{Path: d.Path + name, Dir: d.Path, Name: name}
+	}
+	sub := d.Subfolders[idx]
+	for p := dest; p != nil; p = p.parent {
+		if p == sub {
+			return &fs.PathError{Op: "rename", Path: sub.Path, Err: errMoveIntoSelf}
+		}
+	}
+	d.Subfolders = append(d.Subfolders[:idx], d.Subfolders[idx+1:]...)
+	sub.Name = newName
+	sub.Hash = dest.version.Hash(newName)
+	sub.setPath(dest.Path + newName + "/")
+	if dest != d {
+		sub.entry = 0
+	}
+	dest.insertDir(sub)
+	d.invalidate()
+	dest.invalidate()
+	return nil
+}
+
+// prepare loads d and ensures name is valid and unused in d
+func (d *Directory) prepare(op, name string) error {
+	if err := d.Load(); err != nil {
+		return err
+	}
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return &fs.PathError{Op: op, Path: d.Path + name, Err: fs.ErrInvalid}
+	}
+	_, isFile := d.fileIndex(name)
+	_, isDir := d.dirIndex(name)
+	if isFile || isDir {
+		return &fs.PathError{Op: op, Path: d.Path + name, Err: fs.ErrExist}
+	}
+	return nil
+}
+
+// invalidate clears cached digest of d and its ancestors
+func (d *Directory) invalidate() {
+	for p := d; p != nil; p = p.parent {
+		p.digest = p.digest[:0]
+	}
+}
+
+// setPath changes Path of d and everything inside it
+func (d *Directory) setPath(path string) {
+	d.Path = path
+	for _, f := range d.Files {
+		f.Path = path + f.Name
+	}
+	for _, sub := range d.Subfolders {
+		sub.setPath(path + sub.Name + "/")
+	}
+	if d.lazy == nil {
+		return
+	}
+
+	// children found by Lookup are reused when loading
+	d.lazy.mu.Lock()
+	defer d.lazy.mu.Unlock()
+	for _, n := range d.lazy.found {
+		switch x := n.(type) {
+		case *File:
+			x.Path = path + x.Name
+		case *Directory:
+			x.setPath(path + x.Name + "/")
+		}
+	}
+}
+
+func (d *Directory) fileIndex(name string) (idx int, ok bool) {
+	idx = sort.Search(len(d.Files), func(i int) bool { return d.Files[i].Name >= name })
+	return idx, idx < len(d.Files) && d.Files[idx].Name == name
+}
+
+func (d *Directory) dirIndex(name string) (idx int, ok bool) {
+	idx = sort.Search(len(d.Subfolders), func(i int) bool { return d.Subfolders[i].Name >= name })
+	return idx, idx < len(d.Subfolders) && d.Subfolders[idx].Name == name
+}
+
+func (d *Directory) insertFile(f *File) {
+	idx, _ := d.fileIndex(f.Name)
+	d.Files = append(d.Files, nil)
+	copy(d.Files[idx+1:], d.Files[idx:])
+	d.Files[idx] = f
+}
+
+func (d *Directory) insertDir(sub *Directory) {
+	idx, _ := d.dirIndex(sub.Name)
+	d.Subfolders = append(d.Subfolders, nil)
+	copy(d.Subfolders[idx+1:], d.Subfolders[idx:])
+	d.Subfolders[idx] = sub
+	sub.parent = d
+}
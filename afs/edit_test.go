@@ -0,0 +1,73 @@
+package afs_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// checkHash fails the test if hash of any node under d does not match its name
+func checkHash(t *testing.T, d *afs.Directory, v record.Version) {
+	for _, f := range d.Files {
+		if f.Hash != v.Hash(f.Name) {
+			t.Errorf("hash of %s is %x, expected %x", f.Path, f.Hash, v.Hash(f.Name))
+		}
+	}
+	for _, sub := range d.Subfolders {
+		if sub.Hash != v.Hash(sub.Name) {
+			t.Errorf("hash of %s is %x, expected %x", sub.Path, sub.Hash, v.Hash(sub.Name))
+		}
+		checkHash(t, sub, v)
+	}
+}
+
+func TestEditHash(t *testing.T) {
+	for _, v := range []record.Version{record.Version3, record.Version4} {
+		root, err := afs.FromGGPK(bytes.NewReader(pack(t, newTree(t, digestTree), v)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := root.LookupDir("Data")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = data.Mkdir("新"); err != nil {
+			t.Fatal(err)
+		}
+		if err = data.AddFile(newFile("𝄞.dat", "x")); err != nil {
+			t.Fatal(err)
+		}
+		if err = data.Rename("x.dat", data, "X2.dat"); err != nil {
+			t.Fatal(err)
+		}
+		if err = root.Rename("a.txt", data, "moved.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if err = root.Rename("Art", data, "Art2"); err != nil {
+			t.Fatal(err)
+		}
+		checkHash(t, root, v)
+	}
+}
+
+func TestFromDirectoryHash(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "Data", "Sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, fn := range []string{"a.txt", "Data/中文.txt", "Data/Sub/𝄞.ogg"} {
+		if err := os.WriteFile(filepath.Join(dir, fn), []byte(fn), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root, err := afs.FromDirectory(dir, afs.Reject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkHash(t, root, record.Version3)
+}
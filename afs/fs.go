@@ -0,0 +1,246 @@
+package afs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"sort"
+	"time"
+)
+
+// Directory implements fs.FS, fs.ReadDirFS, fs.StatFS and fs.ReadFileFS, names
+// are slash separated paths relative to the directory, as io/fs requires.
+//
+// Files and Subfolders must be sorted by name, as FromGGPK does. Use Sort if
+// you build the tree by hand.
+var (
+	_ fs.ReadDirFS  = (*Directory)(nil)
+	_ fs.StatFS     = (*Directory)(nil)
+	_ fs.ReadFileFS = (*Directory)(nil)
+)
+
+// Sort sorts Files and Subfolders of d and all its loaded subfolders by name
+func (d *Directory) Sort() {
+	sort.Sort(ByName(d.Files))
+	sort.Sort(ByPath(d.Subfolders))
+	for _, sub := range d.Subfolders {
+		sub.Sort()
+	}
+}
+
+// file finds direct child file by name, using binary search
+func (d *Directory) file(name string) *File {
+	if idx, ok := d.fileIndex(name); ok {
+		return d.Files[idx]
+	}
+	return nil
+}
+
+// subfolder finds direct child directory by name, using binary search
+func (d *Directory) subfolder(name string) *Directory {
+	if idx, ok := d.dirIndex(name); ok {
+		return d.Subfolders[idx]
+	}
+	return nil
+}
+
+// resolve finds file or directory by io/fs style name
+func (d *Directory) resolve(op, name string) (*Directory, *File, error) {
+	if !fs.ValidPath(name) {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return d, nil, nil
+	}
+
+	n, err := d.Lookup(name)
+	if _, ok := err.(*NotFoundError); ok {
+		err = fs.ErrNotExist
+	}
+	if err != nil {
+		return nil, nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if f, ok := n.(*File); ok {
+		return nil, f, nil
+	}
+	return n.(*Directory), nil, nil
+}
+
+// Open opens named file or directory
+func (d *Directory) Open(name string) (fs.File, error) {
+	dir, file, err := d.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if file != nil {
+		return file.Open()
+	}
+	return &dirHandle{dir: dir}, nil
+}
+
+// Stat returns FileInfo describing named file or directory
+func (d *Directory) Stat(name string) (fs.FileInfo, error) {
+	dir, file, err := d.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	if file != nil {
+		return file.Info(), nil
+	}
+	return dir.Info(), nil
+}
+
+// ReadFile reads whole content of named file
+func (d *Directory) ReadFile(name string) ([]byte, error) {
+	_, file, err := d.resolve("readfile", name)
+	if err != nil {
+		return nil, err
+	}
+	if file == nil {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: errIsDir}
+	}
+	return file.Content()
+}
+
+// ReadDir lists named directory, sorted by name
+func (d *Directory) ReadDir(name string) ([]fs.DirEntry, error) {
+	dir, _, err := d.resolve("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if dir == nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: errNotDir}
+	}
+	return dir.entries()
+}
+
+// entries returns direct children of d as fs.DirEntry, sorted by name
+func (d *Directory) entries() ([]fs.DirEntry, error) {
+	if err := d.Load(); err != nil {
+		return nil, err
+	}
+
+	ret := make([]fs.DirEntry, 0, len(d.Files)+len(d.Subfolders))
+	for _, f := range d.Files {
+		ret = append(ret, fs.FileInfoToDirEntry(f.Info()))
+	}
+	for _, sub := range d.Subfolders {
+		ret = append(ret, fs.FileInfoToDirEntry(sub.Info()))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Name() < ret[j].Name() })
+	return ret, nil
+}
+
+var (
+	errIsDir  = errors.New("is a directory")
+	errNotDir = errors.New("not a directory")
+)
+
+// FileInfo describes afs file or directory, implements fs.FileInfo
+type FileInfo struct {
+	file *File
+	dir  *Directory
+}
+
+// Info returns FileInfo describing f
+func (f *File) Info() *FileInfo {
+	return &FileInfo{file: f}
+}
+
+// Info returns FileInfo describing d
+func (d *Directory) Info() *FileInfo {
+	return &FileInfo{dir: d}
+}
+
+// Name returns base name, "." for root directory
+func (i *FileInfo) Name() string {
+	if i.file != nil {
+		return i.file.Name
+	}
+	if i.dir.Name == "" {
+		return "."
+	}
+	return i.dir.Name
+}
+
+// Size returns file size, 0 for directory
+func (i *FileInfo) Size() int64 {
+	if i.file != nil {
+		return int64(i.file.Size)
+	}
+	return 0
+}
+
+// Mode returns read-only permission bits
+func (i *FileInfo) Mode() fs.FileMode {
+	if i.file != nil {
+		return 0444
+	}
+	return fs.ModeDir | 0555
+}
+
+// ModTime converts Timestamp to time.Time
+func (i *FileInfo) ModTime() time.Time {
+	if i.file != nil {
+		return time.Unix(int64(i.file.Timestamp), 0)
+	}
+	return time.Unix(int64(i.dir.Timestamp), 0)
+}
+
+// IsDir reports whether it describes a directory
+func (i *FileInfo) IsDir() bool {
+	return i.dir != nil
+}
+
+// Sys returns described *File or *Directory
+func (i *FileInfo) Sys() interface{} {
+	if i.file != nil {
+		return i.file
+	}
+	return i.dir
+}
+
+// Digest returns sha256 digest of file content, or digest of directory
+func (i *FileInfo) Digest() []byte {
+	if i.file != nil {
+		return i.file.Digest
+	}
+	return i.dir.Digest()
+}
+
+// dirHandle is opened afs directory, implements fs.ReadDirFile
+type dirHandle struct {
+	dir     *Directory
+	entries []fs.DirEntry
+	pos     int
+}
+
+func (h *dirHandle) Stat() (fs.FileInfo, error) {
+	return h.dir.Info(), nil
+}
+
+func (h *dirHandle) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: h.dir.Path, Err: errIsDir}
+}
+
+func (h *dirHandle) Close() error {
+	return nil
+}
+
+func (h *dirHandle) ReadDir(n int) (ret []fs.DirEntry, err error) {
+	if h.entries == nil {
+		if h.entries, err = h.dir.entries(); err != nil {
+			return
+		}
+	}
+
+	rest := h.entries[h.pos:]
+	if n > 0 && len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > 0 && n < len(rest) {
+		rest = rest[:n]
+	}
+	h.pos += len(rest)
+	return rest, nil
+}
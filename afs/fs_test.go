@@ -0,0 +1,40 @@
+package afs_test
+
+import (
+	"bytes"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+func TestFS(t *testing.T) {
+	var expected []string
+	for p := range resolveTree {
+		expected = append(expected, p)
+	}
+
+	for _, v := range []record.Version{record.Version3, record.Version4} {
+		data := pack(t, newTree(t, resolveTree), v)
+		eager, err := afs.FromGGPK(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		lazy, err := afs.FromGGPKLazy(bytes.NewReader(data), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, root := range map[string]*afs.Directory{"eager": eager, "lazy": lazy} {
+			if err = fstest.TestFS(root, expected...); err != nil {
+				t.Errorf("v%d %s: %v", v, name, err)
+			}
+		}
+	}
+
+	tree := newTree(t, resolveTree)
+	tree.Sort()
+	if err := fstest.TestFS(tree, expected...); err != nil {
+		t.Errorf("hand built: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package afs
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// Matcher matches slash separated paths against glob patterns
+//
+// Besides syntax of path.Match, pattern supports:
+//
+//	**        as a whole path segment, matches zero or more segments
+//	[!a-z]    same as [^a-z]
+//	{a,b,c}   matches any of alternatives, can be nested
+//	!pattern  excludes paths matching pattern
+//
+// A path matches if it matches any pattern, and none of excluding patterns.
+// If there are only excluding patterns, everything else matches. Leading
+// slashes of patterns and paths are ignored.
+type Matcher struct {
+	include []pattern
+	exclude []pattern
+}
+
+// pattern is a glob pattern without braces, split into segments
+type pattern []string
+
+// NewMatcher compiles patterns into Matcher
+func NewMatcher(patterns ...string) (m *Matcher, err error) {
+	m = &Matcher{}
+	for _, p := range patterns {
+		neg := strings.HasPrefix(p, "!")
+		if neg {
+			p = p[1:]
+		}
+		expanded, err := expand(strings.TrimLeft(p, "/"))
+		if err != nil {
+			return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+		}
+
+		for _, e := range expanded {
+			segs := pattern(strings.Split(e, "/"))
+			for k, s := range segs {
+				s = strings.ReplaceAll(s, "[!", "[^")
+				if _, err := path.Match(s, ""); err != nil {
+					return nil, fmt.Errorf("bad pattern %q: %w", p, err)
+				}
+				segs[k] = s
+			}
+			if neg {
+				m.exclude = append(m.exclude, segs)
+			} else {
+				m.include = append(m.include, segs)
+			}
+		}
+	}
+	return
+}
+
+// NewFilter compiles Matcher from patterns to include and patterns to
+// exclude, which are written without leading "!"
+func NewFilter(include, exclude []string) (*Matcher, error) {
+	patterns := append([]string{}, include...)
+	for _, p := range exclude {
+		patterns = append(patterns, "!"+p)
+	}
+	return NewMatcher(patterns...)
+}
+
+// Match reports whether file at path p matches
+func (m *Matcher) Match(p string) bool {
+	segs := split(p)
+	for _, x := range m.exclude {
+		if x.match(segs) {
+			return false
+		}
+	}
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, x := range m.include {
+		if x.match(segs) {
+			return true
+		}
+	}
+	return false
+}
+
+// MayContain reports whether something inside directory at path p might match
+func (m *Matcher) MayContain(p string) bool {
+	segs := split(p)
+	for _, x := range m.exclude {
+		if x.excludesAll(segs) {
+			return false
+		}
+	}
+	if len(m.include) == 0 {
+		return true
+	}
+	for _, x := range m.include {
+		for _, i := range x.prefix(segs) {
+			if i < len(x) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Glob returns files inside d matching patterns, see Matcher
+//
+// Paths are matched relative to d, directories cannot contain matching files
+// are not visited.
+func (d *Directory) Glob(patterns ...string) (ret []*File, err error) {
+	m, err := NewMatcher(patterns...)
+	if err != nil {
+		return
+	}
+
+	err = d.Walk(func(n Node) error {
+		switch x := n.(type) {
+		case *Directory:
+			if x != d && !m.MayContain(strings.TrimPrefix(x.Path, d.Path)) {
+				return fs.SkipDir
+			}
+		case *File:
+			if m.Match(strings.TrimPrefix(x.Path, d.Path)) {
+				ret = append(ret, x)
+			}
+		}
+		return nil
+	})
+	return
+}
+
+func split(p string) []string {
+	p = strings.Trim(p, "/")
+	if p == "" {
+		return nil
+	}
+	return strings.Split(p, "/")
+}
+
+// prefix matches segs against beginning of x, returns indexes of remaining
+// segments of x, len(x) means whole x is matched
+func (x pattern) prefix(segs []string) []int {
+	states := x.closure([]int{0})
+	for _, s := range segs {
+		next := []int{}
+		for _, i := range states {
+			switch {
+			case i == len(x):
+			case x[i] == "**":
+				next = append(next, i)
+			default:
+				if ok, _ := path.Match(x[i], s); ok {
+					next = append(next, i+1)
+				}
+			}
+		}
+		if states = x.closure(next); len(states) == 0 {
+			break
+		}
+	}
+	return states
+}
+
+// closure adds states reachable by matching ** with nothing
+func (x pattern) closure(states []int) []int {
+	seen := map[int]bool{}
+	ret := make([]int, 0, len(states))
+	for len(states) > 0 {
+		i := states[0]
+		states = states[1:]
+		if seen[i] {
+			continue
+		}
+		seen[i] = true
+		ret = append(ret, i)
+		if i < len(x) && x[i] == "**" {
+			states = append(states, i+1)
+		}
+	}
+	return ret
+}
+
+func (x pattern) match(segs []string) bool {
+	for _, i := range x.prefix(segs) {
+		if i == len(x) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludesAll reports whether x matches everything inside directory segs
+func (x pattern) excludesAll(segs []string) bool {
+	for _, i := range x.prefix(segs) {
+		if i == len(x)-1 && x[i] == "**" {
+			return true
+		}
+	}
+	return false
+}
+
+// expand expands brace alternations of p
+func expand(p string) ([]string, error) {
+	start, depth := -1, 0
+	alts, last := []string{}, 0
+	for i := 0; i < len(p); i++ {
+		switch p[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start, last = i, i+1
+			}
+			depth++
+		case ',':
+			if depth == 1 {
+				alts = append(alts, p[last:i])
+				last = i + 1
+			}
+		case '}':
+			if depth == 0 {
+				return nil, fmt.Errorf("unmatched '}'")
+			}
+			if depth--; depth > 0 {
+				continue
+			}
+			alts = append(alts, p[last:i])
+			rest, err := expand(p[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			ret := []string{}
+			for _, a := range alts {
+				heads, err := expand(p[:start] + a)
+				if err != nil {
+					return nil, err
+				}
+				for _, h := range heads {
+					for _, r := range rest {
+						ret = append(ret, h+r)
+					}
+				}
+			}
+			return ret, nil
+		}
+	}
+	if depth > 0 {
+		return nil, fmt.Errorf("unmatched '{'")
+	}
+	return []string{p}, nil
+}
@@ -0,0 +1,35 @@
+package afs_test
+
+import (
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+)
+
+func TestNewFilter(t *testing.T) {
+	m, err := afs.NewFilter([]string{"Data/**/*.dat", "*.txt"}, []string{"**/skip*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]bool{
+		"/Data/Mods.dat":       true,
+		"/Data/sub/x.dat":      true,
+		"/Data/sub/skip.dat":   false,
+		"/a.txt":               true,
+		"/skip.txt":            false,
+		"/Art/icon.dds":        false,
+		"/Data/sub/readme.txt": false,
+	}
+	for p, want := range cases {
+		if got := m.Match(p); got != want {
+			t.Errorf("Match(%q) = %v, expected %v", p, got, want)
+		}
+	}
+
+	if _, err = afs.NewFilter(nil, []string{"[a-"}); err == nil {
+		t.Error("bad exclude pattern is accepted")
+	}
+	if m, err = afs.NewFilter(nil, []string{"*.dds"}); err != nil || !m.Match("/a.txt") || m.Match("/b.dds") {
+		t.Errorf("only excludes: %v", err)
+	}
+}
@@ -0,0 +1,68 @@
+package afs_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"strings"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/generate"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// newFile creates afs file holding content
+func newFile(name, content string) *afs.File {
+	sum := sha256.Sum256([]byte(content))
+	return &afs.File{
+		Name:     name,
+		Digest:   sum[:],
+		Size:     uint64(len(content)),
+		OrigFile: strings.NewReader(content),
+	}
+}
+
+// newTree creates afs tree from slash separated paths and contents
+func newTree(t testing.TB, files map[string]string) *afs.Directory {
+	root := afs.Root()
+	root.Path = "/"
+	for p, content := range files {
+		segs := strings.Split(p, "/")
+		cur := root
+		for _, name := range segs[:len(segs)-1] {
+			sub, err := cur.LookupDir(name)
+			if err != nil {
+				if sub, err = cur.Mkdir(name); err != nil {
+					t.Fatal(err)
+				}
+			}
+			cur = sub
+		}
+		if err := cur.AddFile(newFile(segs[len(segs)-1], content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+// pack writes root as ggpk file of version v
+func pack(t testing.TB, root *afs.Directory, v record.Version) []byte {
+	buf := &bytes.Buffer{}
+	ggg := record.NewGGG(v)
+	ggg.Offsets[0] = uint64(ggg.ByteLength())
+	if err := ggg.Save(buf); err != nil {
+		t.Fatal(err)
+	}
+
+	dirs, files, raws := generate.FromAFS(root, uint64(ggg.Header.Length), generate.Options{Version: v})
+	for _, d := range dirs {
+		d.Save(buf)
+	}
+	for _, f := range files {
+		f.Save(buf)
+	}
+	for _, r := range raws {
+		r.Save(buf)
+	}
+	return buf.Bytes()
+}
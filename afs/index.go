@@ -0,0 +1,233 @@
+package afs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// indexFormat is bumped whenever layout of index changes
+const indexFormat = 3
+
+var errStaleIndex = errors.New("index does not match ggpk file")
+
+// index is afs structure serialized to user cache directory
+type index struct {
+	Format  int
+	Size    int64  // size of ggpk file
+	ModTime int64  // modification time of ggpk file, in nanoseconds
+	Digest  []byte // digest of root directory stored in ggpk file
+	Root    indexDir
+}
+
+type indexDir struct {
+	Name        string
+	Hash        uint32
+	Offset      uint64
+	Digest      []byte // digest stored in ggpk file
+	Sorted      bool   // Digest can be used as is, see FromDirectoryRecord
+	Entry       int
+	Files       []indexFile
+	Subfolders  []indexDir
+	Attachments []indexAttachment
+}
+
+type indexFile struct {
+	Name   string
+	Hash   uint32
+	Digest []byte
+	Size   uint64
+	Offset uint64
+	Entry  int
+}
+
+// indexAttachment is loaded from ggpk file again, as free records can be large
+type indexAttachment struct {
+	Hash  uint32
+	Start uint64 // offset of the record, header included
+	Entry int
+}
+
+// FromGGPKCached is FromGGPK, but afs structure is cached in user cache directory
+//
+// Cache is keyed by size and modification time of f, and digest of root
+// directory stored in f, so a changed ggpk file is parsed again
+// automatically. f should be *os.File or *os.File wrapped by Verify,
+// others are not cached. Failing to write the cache is not an error.
+func FromGGPKCached(f io.ReaderAt) (root *Directory, err error) {
+	file, ok := osFile(f)
+	if !ok {
+		return FromGGPK(f)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return
+	}
+	r, v, _, rootdir, err := readRoot(f)
+	if err != nil {
+		return
+	}
+
+	fn, err := indexPath(file.Name())
+	if err != nil {
+		return FromGGPK(f)
+	}
+	key := index{
+		Format:  indexFormat,
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Digest:  rootdir.Digest,
+	}
+	if root, err = readIndex(fn, key, r, v); err == nil {
+		return
+	}
+
+	if root, err = FromGGPK(f); err != nil {
+		return
+	}
+	key.Root = toIndex(root)
+	writeIndex(fn, key)
+	return
+}
+
+// osFile extracts *os.File from f
+func osFile(f io.ReaderAt) (file *os.File, ok bool) {
+	if v, isVerified := f.(verified); isVerified {
+		f = v.ReaderAt
+	}
+	file, ok = f.(*os.File)
+	return
+}
+
+// indexPath returns where index of ggpk file fn is cached
+func indexPath(fn string) (ret string, err error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return
+	}
+	if fn, err = filepath.Abs(fn); err != nil {
+		return
+	}
+	sum := sha256.Sum256([]byte(fn))
+	ret = filepath.Join(dir, "ggpk", hex.EncodeToString(sum[:])+".idx")
+	return
+}
+
+func readIndex(fn string, key index, f io.ReaderAt, v record.Version) (root *Directory, err error) {
+	file, err := os.Open(fn)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var idx index
+	if err = gob.NewDecoder(file).Decode(&idx); err != nil {
+		return
+	}
+	if idx.Format != key.Format || idx.Size != key.Size || idx.ModTime != key.ModTime || !bytes.Equal(idx.Digest, key.Digest) {
+		return nil, errStaleIndex
+	}
+
+	root = &Directory{Path: "/"}
+	err = idx.Root.build(root, f, v)
+	return
+}
+
+// writeIndex saves idx to fn atomically
+func writeIndex(fn string, idx index) (err error) {
+	dir := filepath.Dir(fn)
+	if err = os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(dir, "*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	err = gob.NewEncoder(tmp).Encode(idx)
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fn)
+	}
+	return
+}
+
+func toIndex(d *Directory) (ret indexDir) {
+	ret = indexDir{
+		Name:        d.Name,
+		Hash:        d.Hash,
+		Offset:      d.Offset,
+		Digest:      d.stored,
+		Sorted:      d.stored != nil && bytes.Equal(d.digest, d.stored),
+		Entry:       d.entry,
+		Files:       make([]indexFile, len(d.Files)),
+		Subfolders:  make([]indexDir, len(d.Subfolders)),
+		Attachments: make([]indexAttachment, len(d.Attachments)),
+	}
+	for k, f := range d.Files {
+		ret.Files[k] = indexFile{f.Name, f.Hash, f.Digest, f.Size, f.Offset, f.entry}
+	}
+	for k, s := range d.Subfolders {
+		ret.Subfolders[k] = toIndex(s)
+	}
+	for k, a := range d.Attachments {
+		ret.Attachments[k] = indexAttachment{a.Hash, a.Record.Header.Start(), a.entry}
+	}
+	return
+}
+
+// build fills d with content of x, d.Path must be set
+func (x *indexDir) build(d *Directory, f io.ReaderAt, v record.Version) error {
+	d.Name = x.Name
+	d.Hash = x.Hash
+	d.Offset = x.Offset
+	if x.Sorted {
+		d.digest = x.Digest
+	}
+	d.stored = x.Digest
+	d.version = v
+	d.entry = x.Entry
+	d.Files = make([]*File, len(x.Files))
+	d.Subfolders = make([]*Directory, len(x.Subfolders))
+	d.Attachments = make([]*Attachment, 0, len(x.Attachments))
+
+	for k, file := range x.Files {
+		d.Files[k] = &File{
+			Path:     d.Path + file.Name,
+			Name:     file.Name,
+			Hash:     file.Hash,
+			Digest:   file.Digest,
+			Size:     file.Size,
+			Offset:   file.Offset,
+			OrigFile: f,
+			entry:    file.Entry,
+		}
+	}
+	for k := range x.Subfolders {
+		sub := &x.Subfolders[k]
+		d.Subfolders[k] = &Directory{Path: d.Path + sub.Name + "/", parent: d}
+		if err := sub.build(d.Subfolders[k], f, v); err != nil {
+			return err
+		}
+	}
+	for _, a := range x.Attachments {
+		h, rec, err := record.Decode(f, a.Start, v)
+		if err != nil {
+			return err
+		}
+		if err = attach(f, h, rec, d, a.Hash, a.Entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package afs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// attachFree appends a free record to data, and makes entry k of root directory point to it
+func attachFree(t *testing.T, data []byte, k int) []byte {
+	start := uint64(len(data))
+	buf := bytes.NewBuffer(data)
+	if err := record.NewFree(16, 0).Save(buf); err != nil {
+		t.Fatal(err)
+	}
+	data = buf.Bytes()
+
+	breakEntry(t, data, k)
+	r := bytes.NewReader(data)
+	ggg, err := record.GGG(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := record.Directory(r, ggg.Offsets[0], ggg.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := uint64(root.Entries[0].ByteLength())
+	pos := ggg.Offsets[0] + 8 + uint64(root.ByteLength()) - uint64(len(root.Entries))*size + uint64(k)*size + 4
+	binary.LittleEndian.PutUint64(data[pos:], start)
+	return data
+}
+
+// sameTree fails the test if got differs from want in digests, order of entries or attachments
+func sameTree(t *testing.T, got, want *afs.Directory, v record.Version) {
+	if got.Path != want.Path || got.Hash != want.Hash || got.Offset != want.Offset {
+		t.Errorf("%s: got %s (hash %x, offset %d), expected hash %x, offset %d", want.Path, got.Path, got.Hash, got.Offset, want.Hash, want.Offset)
+	}
+	if !bytes.Equal(got.StoredDigest(), want.StoredDigest()) || !bytes.Equal(got.Digest(), want.Digest()) {
+		t.Errorf("%s: digests are %x and %x, expected %x and %x", want.Path, got.StoredDigest(), got.Digest(), want.StoredDigest(), want.Digest())
+	}
+
+	a, b := got.Entries(v, true), want.Entries(v, true)
+	if len(a) != len(b) {
+		t.Fatalf("%s: got %d entries, expected %d", want.Path, len(a), len(b))
+	}
+	for k := range b {
+		if a[k].Hash != b[k].Hash || (a[k].Node == nil) != (b[k].Node == nil) {
+			t.Fatalf("%s: entry %d differs", want.Path, k)
+		}
+		if b[k].Node == nil {
+			x, y := a[k].Attachment, b[k].Attachment
+			if x.Hash != y.Hash || x.Record.Header != y.Record.Header || !bytes.Equal(x.Record.Data, y.Record.Data) {
+				t.Errorf("%s: attachment %d is %+v, expected %+v", want.Path, k, x.Record.Header, y.Record.Header)
+			}
+			continue
+		}
+		if a[k].Node.Info().Name() != b[k].Node.Info().Name() {
+			t.Errorf("%s: entry %d is %s, expected %s", want.Path, k, a[k].Node.Info().Name(), b[k].Node.Info().Name())
+		}
+		if sub, ok := b[k].Node.(*afs.Directory); ok {
+			sameTree(t, a[k].Node.(*afs.Directory), sub, v)
+		} else if !bytes.Equal(a[k].Node.(*afs.File).Digest, b[k].Node.(*afs.File).Digest) {
+			t.Errorf("%s: digest of entry %d differs", want.Path, k)
+		}
+	}
+}
+
+func TestFromGGPKCached(t *testing.T) {
+	for _, v := range []record.Version{record.Version3, record.Version4} {
+		cache := t.TempDir()
+		t.Setenv("XDG_CACHE_HOME", cache)
+		data := attachFree(t, pack(t, newTree(t, digestTree), v), 1)
+		fn := filepath.Join(t.TempDir(), "Content.ggpk")
+		if err := os.WriteFile(fn, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Unix(1600000000, 0)
+		if err := os.Chtimes(fn, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+
+		open := func() *afs.Directory {
+			f, err := os.Open(fn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			root, err := afs.FromGGPKCached(f)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return root
+		}
+
+		// index is rewritten only if it is stale, so its modification time tells
+		aged := time.Unix(1000000000, 0)
+		var idx string
+		rebuilt := func() bool {
+			info, err := os.Stat(idx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = os.Chtimes(idx, aged, aged); err != nil {
+				t.Fatal(err)
+			}
+			return !info.ModTime().Equal(aged)
+		}
+
+		open()
+		found, _ := filepath.Glob(filepath.Join(cache, "ggpk", "*.idx"))
+		if len(found) != 1 {
+			t.Fatalf("v%d: expected 1 index, found %v", v, found)
+		}
+		idx = found[0]
+		rebuilt()
+
+		warm := open()
+		if rebuilt() {
+			t.Errorf("v%d: index is rebuilt for unchanged file", v)
+		}
+		want, err := afs.FromGGPK(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(want.Attachments) != 1 {
+			t.Fatalf("v%d: expected 1 attachment, got %d", v, len(want.Attachments))
+		}
+		sameTree(t, warm, want, v)
+
+		mtime = mtime.Add(time.Second)
+		if err = os.Chtimes(fn, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		open()
+		if !rebuilt() {
+			t.Errorf("v%d: index is used after modification time changed", v)
+		}
+
+		data = append(data, 0)
+		if err = os.WriteFile(fn, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(fn, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		open()
+		if !rebuilt() {
+			t.Errorf("v%d: index is used after size changed", v)
+		}
+
+		// same size and modification time, but another root digest
+		ggg, err := record.GGG(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data[ggg.Offsets[0]+8+8] ^= 0xff
+		if err = os.WriteFile(fn, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(fn, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		root := open()
+		if !rebuilt() {
+			t.Errorf("v%d: index is used after root digest changed", v)
+		}
+		if want, _ = afs.FromGGPK(bytes.NewReader(data)); !bytes.Equal(root.StoredDigest(), want.StoredDigest()) {
+			t.Errorf("v%d: stored digest is %x, expected %x", v, root.StoredDigest(), want.StoredDigest())
+		}
+	}
+}
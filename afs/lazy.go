@@ -0,0 +1,269 @@
+package afs
+
+import (
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// DefaultCacheSize is how many directory records are cached by FromGGPKLazy if not specified
+const DefaultCacheSize = 1024
+
+// source is ggpk file shared by every lazily loaded directory
+type source struct {
+	f     io.ReaderAt
+	v     record.Version
+	cache *lru
+}
+
+// dir reads directory record starting at offset off, from cache if possible
+func (s *source) dir(off uint64) (rec record.DirectoryRecord, err error) {
+	if rec, ok := s.cache.get(off); ok {
+		return rec, nil
+	}
+	if rec, err = record.Directory(s.f, off, s.v); err != nil {
+		return
+	}
+	s.cache.put(off, rec)
+	return
+}
+
+// lazy holds states of a directory whose children are decoded on first access
+type lazy struct {
+	src    *source
+	offset uint64 // file offset of the PDIR record
+	mu     sync.Mutex
+	loaded bool
+	found  map[string]Node // children found by Lookup before loading
+}
+
+// FromGGPKLazy builds afs structure from ggpk file like FromGGPK, but only
+// root directory is decoded.
+//
+// Files and Subfolders of a directory are empty until Load is called, which
+// is done implicitly by Resolve, ReadDir and other io/fs methods. Lookup
+// decodes only records along the path, using name hashes. Decoded directory
+// records are cached, up to cacheSize records, DefaultCacheSize if cacheSize
+// is not positive.
+//
+// Call LoadAll before generating ggpk records from it. Digest loads
+// directories whose entries are not sorted by name hash, see Directory.Digest.
+func FromGGPKLazy(f io.ReaderAt, cacheSize int) (root *Directory, err error) {
+	f, v, h, rootdir, err := readRoot(f)
+	if err != nil {
+		return
+	}
+
+	if cacheSize <= 0 {
+		cacheSize = DefaultCacheSize
+	}
+	src := &source{f, v, newLRU(cacheSize)}
+	src.cache.put(h.Start(), rootdir)
+
+	root = src.node(h, rootdir, 0)
+	root.Path = "/"
+	return
+}
+
+// node creates lazily loaded directory from directory record
+func (s *source) node(h record.RecordHeader, rec record.DirectoryRecord, hash uint32) *Directory {
+	d := FromDirectoryRecord(h, rec, hash)
+	d.lazy = &lazy{src: s, offset: h.Start(), found: map[string]Node{}}
+	return d
+}
+
+// child creates node of record found in directory d, reusing the one found by Lookup
+func (d *Directory) child(h record.RecordHeader, rec interface{}, hash uint32) Node {
+	switch x := rec.(type) {
+	case record.DirectoryRecord:
+		if n, ok := d.lazy.found[x.Name].(*Directory); ok {
+			return n
+		}
+		d.lazy.src.cache.put(h.Start(), x)
+		me := d.lazy.src.node(h, x, hash)
+		me.Path = d.Path + me.Name + "/"
+		me.parent = d
+		return me
+	case record.FileRecord:
+		if n, ok := d.lazy.found[x.Name].(*File); ok {
+			return n
+		}
+		me := FromFileRecord(h, x, hash)
+		me.Path = d.Path + me.Name
+		return me
+	}
+	return nil
+}
+
+// Loaded reports whether children of d are decoded
+func (d *Directory) Loaded() bool {
+	if d.lazy == nil {
+		return true
+	}
+	d.lazy.mu.Lock()
+	defer d.lazy.mu.Unlock()
+	return d.lazy.loaded
+}
+
+// Load decodes direct children of lazily loaded directory, it does nothing for other directories
+func (d *Directory) Load() error {
+	if d.lazy == nil {
+		return nil
+	}
+	l := d.lazy
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.loaded {
+		return nil
+	}
+
+	rec, err := l.src.dir(l.offset)
+	if err != nil {
+		return err
+	}
+	// children are assigned only when all of them are decoded, so a failed
+	// Load leaves d untouched and can be retried
+	var (
+		files       []*File
+		subfolders  []*Directory
+		attachments []*Attachment
+	)
+	for k, e := range rec.Entries {
+		h, r, err := record.Decode(l.src.f, e.Offset, l.src.v)
+		if err != nil {
+			return err
+		}
+
+		if _, ok := r.(record.DirectoryRecord); ok && d.ancestor(h.Start()) {
+			return &record.CorruptError{Offset: h.Start(), Tag: h.Tag, Reason: "directory contains itself"}
+		}
+
+		switch n := d.child(h, r, e.Hash).(type) {
+		case *Directory:
+			n.entry = k + 1
+			subfolders = append(subfolders, n)
+		case *File:
+			n.entry = k + 1
+			files = append(files, n)
+		default:
+			a, err := attachment(l.src.f, h, r, e.Hash, k+1)
+			if err != nil {
+				return err
+			}
+			attachments = append(attachments, a)
+		}
+	}
+
+	d.Files = append(d.Files, files...)
+	d.Subfolders = append(d.Subfolders, subfolders...)
+	d.Attachments = append(d.Attachments, attachments...)
+	sort.Sort(ByName(d.Files))
+	sort.Sort(ByPath(d.Subfolders))
+	l.loaded = true
+	l.found = nil
+	return nil
+}
+
+// ancestor reports whether PDIR record at offset off is d or its ancestor
+func (d *Directory) ancestor(off uint64) bool {
+	for p := d; p != nil; p = p.parent {
+		if p.lazy != nil && p.lazy.offset == off {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadAll loads d and all its subfolders recursively
+func (d *Directory) LoadAll() error {
+	return d.loadAll(map[uint64]bool{})
+}
+
+// loadAll loads d recursively, seen holds offsets of directory records loaded
+func (d *Directory) loadAll(seen map[uint64]bool) error {
+	if d.lazy != nil {
+		if seen[d.lazy.offset] {
+			return &record.CorruptError{Offset: d.lazy.offset, Tag: "PDIR", Reason: "record is referenced more than once"}
+		}
+		seen[d.lazy.offset] = true
+	}
+
+	if err := d.Load(); err != nil {
+		return err
+	}
+	for _, sub := range d.Subfolders {
+		if err := sub.loadAll(seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// find finds direct child of unloaded directory by name hash, returns nil if not found
+func (d *Directory) find(name string) (Node, error) {
+	l := d.lazy
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.loaded {
+		// loaded by another goroutine after we checked
+		if f := d.file(name); f != nil {
+			return f, nil
+		}
+		if sub := d.subfolder(name); sub != nil {
+			return sub, nil
+		}
+		return nil, nil
+	}
+	if n, ok := l.found[name]; ok {
+		return n, nil
+	}
+
+	rec, err := l.src.dir(l.offset)
+	if err != nil {
+		return nil, err
+	}
+	h, r, err := rec.Find(l.src.f, name)
+	if err == record.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	n := d.child(h, r, rec.Version.Hash(name))
+	l.found[name] = n
+	return n, nil
+}
+
+// findFold finds direct children of unloaded directory named name case-insensitively by name hash
+//
+// ok is false if d is loaded by another goroutine meanwhile.
+func (d *Directory) findFold(name string) (ret []Node, ok bool, err error) {
+	l := d.lazy
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.loaded {
+		return nil, false, nil
+	}
+
+	rec, err := l.src.dir(l.offset)
+	if err != nil {
+		return
+	}
+	hs, recs, err := rec.FindFold(l.src.f, name)
+	if err != nil {
+		return
+	}
+
+	hash := rec.Version.Hash(name)
+	for k, r := range recs {
+		n := d.child(hs[k], r, hash)
+		ret = append(ret, n)
+		l.found[n.Info().Name()] = n
+	}
+	return ret, true, nil
+}
@@ -0,0 +1,173 @@
+package afs_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// relink makes the only entry of /Data/sub/ point to /Data/, so directories loop
+func relink(t *testing.T) []byte {
+	data := pack(t, newTree(t, map[string]string{
+		"Data/sub/x.txt": "x",
+		"a.txt":          "a",
+	}), record.Version3)
+	r := bytes.NewReader(data)
+
+	ggg, err := record.GGG(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := record.Header(r, ggg.Offsets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := record.ReadDir(r, h, ggg.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataHeader, rec, err := root.Find(r, "Data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	subHeader, rec, err := rec.(record.DirectoryRecord).Find(r, "sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sub := rec.(record.DirectoryRecord)
+	pos := subHeader.Offset + uint64(sub.ByteLength()-sub.Entries[0].ByteLength()) + 4
+	binary.LittleEndian.PutUint64(data[pos:], dataHeader.Start())
+	return data
+}
+
+func TestLoop(t *testing.T) {
+	data := relink(t)
+	var corrupt *record.CorruptError
+
+	if _, err := afs.FromGGPK(bytes.NewReader(data)); !errors.As(err, &corrupt) {
+		t.Errorf("FromGGPK: expected CorruptError, got %v", err)
+	}
+
+	root, err := afs.FromGGPKLazy(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := root.LoadAll(); !errors.As(err, &corrupt) {
+		t.Errorf("LoadAll: expected CorruptError, got %v", err)
+	}
+
+	root, err = afs.FromGGPKLazy(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := root.Walk(func(afs.Node) error { return nil }); !errors.As(err, &corrupt) {
+		t.Errorf("Walk: expected CorruptError, got %v", err)
+	}
+
+	root, err = afs.FromGGPKLazy(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := root.WalkParallel(4, func(afs.Node) error { return nil }); !errors.As(err, &corrupt) {
+		t.Errorf("WalkParallel: expected CorruptError, got %v", err)
+	}
+}
+
+func TestWalkHandBuiltLoop(t *testing.T) {
+	root := newTree(t, map[string]string{"Data/a.txt": "a"})
+	data, err := root.LookupDir("Data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Subfolders = append(data.Subfolders, root)
+
+	if err := root.Walk(func(afs.Node) error { return nil }); err == nil {
+		t.Error("Walk: expected error for loop")
+	}
+}
+
+// breakEntry makes entry k of root directory point past end of file
+func breakEntry(t *testing.T, data []byte, k int) {
+	r := bytes.NewReader(data)
+	ggg, err := record.GGG(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := record.Directory(r, ggg.Offsets[0], ggg.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries := uint64(len(root.Entries) * root.Entries[0].ByteLength())
+	pos := ggg.Offsets[0] + 8 + uint64(root.ByteLength()) - entries + uint64(k*root.Entries[0].ByteLength()) + 4
+	binary.LittleEndian.PutUint64(data[pos:], uint64(len(data))+100)
+}
+
+func TestLoadFailure(t *testing.T) {
+	data := pack(t, newTree(t, map[string]string{
+		"a.txt":      "a",
+		"b.txt":      "b",
+		"c.txt":      "c",
+		"Data/x.dat": "x",
+		"Art/y.dds":  "y",
+	}), record.Version3)
+	breakEntry(t, data, 4)
+
+	root, err := afs.FromGGPKLazy(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = root.Load(); err == nil {
+			t.Fatal("corrupted entry is loaded")
+		}
+		if root.Loaded() || len(root.Files) != 0 || len(root.Subfolders) != 0 || len(root.Attachments) != 0 {
+			t.Fatalf("failed Load #%d leaves %d files and %d subfolders", i+1, len(root.Files), len(root.Subfolders))
+		}
+	}
+}
+
+func TestDigestUnsorted(t *testing.T) {
+	tree := newTree(t, map[string]string{
+		"a.txt":      "a",
+		"b.txt":      "b",
+		"Data/x.dat": "x",
+	})
+	want := tree.Digest()
+	data := pack(t, tree, record.Version3)
+
+	// swap first two entries of root, like ggpk files written by older defrag
+	r := bytes.NewReader(data)
+	ggg, err := record.GGG(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, err := record.Directory(r, ggg.Offsets[0], ggg.Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := root.Entries[0].ByteLength()
+	pos := int(ggg.Offsets[0]) + 8 + root.ByteLength() - len(root.Entries)*size
+	first := append([]byte{}, data[pos:pos+size]...)
+	copy(data[pos:], data[pos+size:pos+2*size])
+	copy(data[pos+size:], first)
+
+	lazy, err := afs.FromGGPKLazy(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lazy.Digest(); !bytes.Equal(got, want) {
+		t.Errorf("digest of unloaded directory is %x, expected %x", got, want)
+	}
+	if err = lazy.LoadAll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := lazy.Info().Digest(); !bytes.Equal(got, want) {
+		t.Errorf("digest after LoadAll is %x, expected %x", got, want)
+	}
+}
@@ -0,0 +1,99 @@
+package afs
+
+import (
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Node is *File or *Directory
+type Node interface {
+	Info() *FileInfo
+}
+
+// NotFoundError reports a path which cannot be found in afs
+type NotFoundError struct {
+	Path string // path being looked up
+	Dir  string // Path of deepest directory found
+	Name string // name which cannot be found in Dir
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("cannot find %s in %s", e.Name, e.Dir)
+}
+
+// Unwrap makes errors.Is(err, fs.ErrNotExist) work
+func (e *NotFoundError) Unwrap() error {
+	return fs.ErrNotExist
+}
+
+// Lookup finds file or directory by slash separated path relative to d
+//
+// Leading and trailing slashes are ignored, so "/Data/Mods.dat" and
+// "Data/Mods.dat" are same. Empty path or "/" is d itself. Files and
+// Subfolders are binary searched, so they must be sorted. Directories not
+// loaded yet are searched by name hash, see FromGGPKLazy.
+func (d *Directory) Lookup(path string) (Node, error) {
+	cur := d
+	nodes := strings.Split(strings.Trim(path, "/"), "/")
+	if len(nodes) == 1 && nodes[0] == "" {
+		return d, nil
+	}
+
+	for idx, node := range nodes {
+		if !cur.Loaded() {
+			n, err := cur.find(node)
+			if err != nil {
+				return nil, err
+			}
+			if f, ok := n.(*File); ok && idx == len(nodes)-1 {
+				return f, nil
+			}
+			next, ok := n.(*Directory)
+			if !ok {
+				return nil, &NotFoundError{path, cur.Path, node}
+			}
+			cur = next
+			continue
+		}
+
+		if idx == len(nodes)-1 {
+			if f := cur.file(node); f != nil {
+				return f, nil
+			}
+		}
+
+		next := cur.subfolder(node)
+		if next == nil {
+			return nil, &NotFoundError{path, cur.Path, node}
+		}
+		cur = next
+	}
+	return cur, nil
+}
+
+// LookupFile finds file by path, see Lookup
+func (d *Directory) LookupFile(path string) (*File, error) {
+	n, err := d.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	f, ok := n.(*File)
+	if !ok {
+		return nil, &fs.PathError{Op: "lookup", Path: path, Err: errIsDir}
+	}
+	return f, nil
+}
+
+// LookupDir finds directory by path, see Lookup
+func (d *Directory) LookupDir(path string) (*Directory, error) {
+	n, err := d.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	dir, ok := n.(*Directory)
+	if !ok {
+		return nil, &fs.PathError{Op: "lookup", Path: path, Err: errNotDir}
+	}
+	return dir, nil
+}
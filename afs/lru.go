@@ -0,0 +1,59 @@
+package afs
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// lru caches decoded directory records by their file offset, least recently used ones are evicted first
+type lru struct {
+	mu    sync.Mutex
+	size  int
+	items map[uint64]*list.Element
+	order *list.List // front is most recently used
+}
+
+type lruEntry struct {
+	off uint64
+	rec record.DirectoryRecord
+}
+
+func newLRU(size int) *lru {
+	return &lru{
+		size:  size,
+		items: make(map[uint64]*list.Element),
+		order: list.New(),
+	}
+}
+
+func (c *lru) get(off uint64) (rec record.DirectoryRecord, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.items[off]
+	if !ok {
+		return
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).rec, true
+}
+
+func (c *lru) put(off uint64, rec record.DirectoryRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.items[off]; ok {
+		e.Value.(*lruEntry).rec = rec
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.items[off] = c.order.PushFront(&lruEntry{off, rec})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*lruEntry).off)
+	}
+}
@@ -0,0 +1,157 @@
+package afs
+
+import "strings"
+
+const (
+	// WhiteoutPrefix marks deletion in overlay layers, file ".wh.name" hides
+	// file or directory "name" of lower layers
+	WhiteoutPrefix = ".wh."
+	// OpaqueWhiteout hides everything of lower layers in the directory containing it
+	OpaqueWhiteout = WhiteoutPrefix + WhiteoutPrefix + ".opq"
+)
+
+// Overlay merges layers over base, returns the merged view as a new tree
+//
+// Layers are applied in order, so last layer is the topmost one. Files in a
+// layer shadow files and directories of same path in lower layers, and
+// directories of same path are merged. Whiteouts (see WhiteoutPrefix and
+// OpaqueWhiteout) in a layer delete things of lower layers, and are not
+// included in result. They can be either files or directories.
+//
+// Lazily loaded trees are loaded fully. Base and layers are not modified,
+// but files of result share content with them, so the result can be listed,
+// extracted, or written with generate.FromAFS.
+func Overlay(base *Directory, layers ...*Directory) (ret *Directory, err error) {
+	if err = base.LoadAll(); err != nil {
+		return
+	}
+	ret = clone(base, base.Path)
+
+	for _, l := range layers {
+		if err = l.LoadAll(); err != nil {
+			return nil, err
+		}
+		if err = ret.merge(l); err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// OverlayDirs is Overlay, with layers read from physic directories at paths
+// by FromDirectory, base is returned as is if paths is empty
+func OverlayDirs(base *Directory, links Symlinks, paths ...string) (*Directory, error) {
+	if len(paths) == 0 {
+		return base, nil
+	}
+	layers := make([]*Directory, 0, len(paths))
+	for _, p := range paths {
+		d, err := FromDirectory(p, links)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, d)
+	}
+	return Overlay(base, layers...)
+}
+
+// clone copies d and everything inside it as a tree at path
+func clone(d *Directory, path string) *Directory {
+	ret := &Directory{
+		Path:        path,
+		Name:        d.Name,
+		Timestamp:   d.Timestamp,
+		Hash:        d.Hash,
+		digest:      d.digest,
+		stored:      d.stored,
+		Subfolders:  make([]*Directory, len(d.Subfolders)),
+		Files:       make([]*File, len(d.Files)),
+		Attachments: append([]*Attachment{}, d.Attachments...),
+		Offset:      d.Offset,
+		entry:       d.entry,
+		version:     d.version,
+	}
+	for k, f := range d.Files {
+		c := *f
+		c.Path = path + c.Name
+		ret.Files[k] = &c
+	}
+	for k, sub := range d.Subfolders {
+		ret.Subfolders[k] = clone(sub, path+sub.Name+"/")
+		ret.Subfolders[k].parent = ret
+	}
+	return ret
+}
+
+// merge applies layer over d
+func (d *Directory) merge(layer *Directory) error {
+	names := make([]string, 0, len(layer.Files)+len(layer.Subfolders))
+	for _, f := range layer.Files {
+		names = append(names, f.Name)
+	}
+	for _, sub := range layer.Subfolders {
+		names = append(names, sub.Name)
+	}
+
+	for _, n := range names {
+		if n == OpaqueWhiteout {
+			d.Files = d.Files[:0]
+			d.Subfolders = d.Subfolders[:0]
+			d.Attachments = d.Attachments[:0]
+			d.invalidate()
+		}
+	}
+	for _, n := range names {
+		if name := strings.TrimPrefix(n, WhiteoutPrefix); name != n && n != OpaqueWhiteout {
+			if err := d.Remove(name); err != nil {
+				if _, ok := err.(*NotFoundError); !ok {
+					return err
+				}
+			}
+		}
+	}
+
+	for _, f := range layer.Files {
+		if strings.HasPrefix(f.Name, WhiteoutPrefix) {
+			continue
+		}
+		c := *f
+		if _, ok := d.dirIndex(c.Name); ok {
+			if err := d.Remove(c.Name); err != nil {
+				return err
+			}
+		}
+		if _, ok := d.fileIndex(c.Name); ok {
+			if err := d.Replace(&c); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.AddFile(&c); err != nil {
+			return err
+		}
+	}
+
+	for _, sub := range layer.Subfolders {
+		if strings.HasPrefix(sub.Name, WhiteoutPrefix) {
+			continue
+		}
+		if _, ok := d.fileIndex(sub.Name); ok {
+			if err := d.Remove(sub.Name); err != nil {
+				return err
+			}
+		}
+		target := d.subfolder(sub.Name)
+		if target == nil {
+			var err error
+			if target, err = d.Mkdir(sub.Name); err != nil {
+				return err
+			}
+			target.Timestamp = sub.Timestamp
+		}
+		if err := target.merge(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package afs_test
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+)
+
+// layer creates physic directory holding files, names ending with slash are directories
+func layer(t *testing.T, files ...string) string {
+	dir := t.TempDir()
+	for _, fn := range files {
+		p := filepath.Join(dir, filepath.FromSlash(fn))
+		if strings.HasSuffix(fn, "/") {
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(fn), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// paths lists paths of every file in d
+func paths(d *afs.Directory) (ret []string) {
+	files, _ := d.AllFiles(afs.DepthFirst)
+	for p := range files {
+		ret = append(ret, p)
+	}
+	sort.Strings(ret)
+	return
+}
+
+func TestOverlayDirs(t *testing.T) {
+	base := newTree(t, map[string]string{
+		"a.txt":         "a",
+		"Data/Mods.dat": "mods",
+		"Data/x.dat":    "x",
+	})
+	if ret, err := afs.OverlayDirs(base, afs.Reject); err != nil || ret != base {
+		t.Fatalf("base is not returned as is without layers: %v", err)
+	}
+
+	ret, err := afs.OverlayDirs(base, afs.Reject,
+		layer(t, "Data/new.dat", "Data/.wh.x.dat"),
+		layer(t, "b.txt", ".wh.a.txt"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Join(paths(ret), ",")
+	if want := "/Data/Mods.dat,/Data/new.dat,/b.txt"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+
+	// whiteouts can be directories
+	ret, err = afs.OverlayDirs(base, afs.Reject, layer(t, ".wh.Data/", ".wh.a.txt/x", "c.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(paths(ret), ","); got != "/c.txt" {
+		t.Errorf("expected /c.txt, got %s", got)
+	}
+	if len(ret.Subfolders) != 0 {
+		t.Errorf("whiteout directory is merged: %s", ret.Subfolders[0].Path)
+	}
+
+	ret, err = afs.OverlayDirs(base, afs.Reject, layer(t, "Data/"+afs.OpaqueWhiteout+"/", "Data/y.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(paths(ret), ","); got != "/Data/y.dat,/a.txt" {
+		t.Errorf("expected /Data/y.dat,/a.txt, got %s", got)
+	}
+
+	if _, err = afs.OverlayDirs(base, afs.Reject, filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("missing layer is accepted")
+	}
+}
@@ -2,92 +2,113 @@ package afs
 
 import (
 	"errors"
-	"log"
-	"os"
+	"io"
 	"sort"
 
 	"github.com/Patrolavia/ggpk/record"
 )
 
 // FromGGPK builds afs structure from ggpk file
-func FromGGPK(f *os.File) (root *Directory, err error) {
-	// test if we can seek, also ensure we are at very beginning of file
-	if _, err = f.Seek(0, 0); err != nil {
+//
+// Malformed records are reported as *record.CorruptError.
+func FromGGPK(f io.ReaderAt) (root *Directory, err error) {
+	f, v, h, rootdir, err := readRoot(f)
+	if err != nil {
 		return
 	}
 
+	// create afs root
+	l := &loader{f, v, map[uint64]bool{h.Start(): true}}
+	root = FromDirectoryRecord(h, rootdir, 0)
+	root.Path = "/"
+
+	for k, e := range rootdir.Entries {
+		if err = l.doEntry(e, root, k+1); err != nil {
+			return
+		}
+	}
+
+	sort.Sort(ByName(root.Files))
+	sort.Sort(ByPath(root.Subfolders))
+	return
+}
+
+// readRoot reads root directory record from ggpk file
+//
+// Returned reader should be used instead of f, which validates records cheaply.
+func readRoot(f io.ReaderAt) (r io.ReaderAt, v record.Version, h record.RecordHeader, rootdir record.DirectoryRecord, err error) {
+	// query file size only once, so records can be validated cheaply
+	r = f
+	if size := record.Size(f); size >= 0 {
+		r = io.NewSectionReader(f, 0, size)
+		if _, ok := f.(verified); ok {
+			r = verified{r}
+		}
+	}
+
 	// read GGPK sign
-	rootNode, err := record.GGG(f)
+	rootNode, err := record.GGG(r)
 	if err != nil {
 		return
 	}
-	if rootNode.Header.Tag != "GGPK" {
-		return root, errors.New("This file is not GGPK file")
-	}
+	v = rootNode.Version
 
 	// find root directory
-	nodes, err := rootNode.Children(f)
+	nodes, err := rootNode.Children(r)
 	if err != nil {
-		log.Fatalf("Cannot read root nodes from ggpk: %s", err)
+		return
 	}
-	var rootDirNode record.RecordHeader
 	for _, n := range nodes {
 		if n.Tag == "PDIR" {
-			rootDirNode = n
+			h = n
 			break
 		}
 	}
 
-	if rootDirNode.Tag != "PDIR" {
-		return root, errors.New("Cannot find root directory from ggpk")
+	if h.Tag != "PDIR" {
+		err = errors.New("Cannot find root directory from ggpk")
+		return
 	}
 
-	// create afs root
-	rootdir, err := record.ReadDir(f, rootDirNode)
-	if err != nil {
+	if rootdir, err = record.ReadDir(r, h, v); err != nil {
 		return
 	}
 	if rootdir.Name != "" {
-		return root, errors.New("root dir name is not empty")
-	}
-	root = FromDirectoryRecord(rootDirNode, rootdir, 0)
-	root.Path = "/"
-
-	for _, e := range rootdir.Entries {
-		if err = doEntry(f, e, root); err != nil {
-			return
-		}
+		err = errors.New("root dir name is not empty")
 	}
-
-	sort.Sort(ByName(root.Files))
-	sort.Sort(ByPath(root.Subfolders))
 	return
 }
 
-func doEntry(f *os.File, e record.DirectoryEntry, cur *Directory) error {
-	if _, err := f.Seek(int64(e.Offset), 0); err != nil {
-		return err
-	}
-	h, err := record.Header(f)
-	if err != nil {
-		return err
-	}
-	h.Offset = e.Offset + uint64(h.ByteLength())
-	return doHeader(f, h, cur, e.Timestamp)
+// loader holds states needed when building afs from ggpk file
+type loader struct {
+	f    io.ReaderAt
+	v    record.Version
+	seen map[uint64]bool // records already loaded, to prevent looping forever
 }
 
-func doDir(f *os.File, h record.RecordHeader, cur *Directory, t uint32) error {
-	dir, err := record.ReadDir(f, h)
+// doEntry loads record of entry e, which is the idx-th entry of cur, starting from 1
+func (l *loader) doEntry(e record.DirectoryEntry, cur *Directory, idx int) error {
+	if l.seen[e.Offset] {
+		return &record.CorruptError{Offset: e.Offset, Reason: "record is referenced more than once"}
+	}
+	l.seen[e.Offset] = true
+
+	h, rec, err := record.Decode(l.f, e.Offset, l.v)
 	if err != nil {
 		return err
 	}
+	return l.doRecord(h, rec, cur, e.Hash, idx)
+}
 
-	me := FromDirectoryRecord(h, dir, t)
+func (l *loader) doDir(h record.RecordHeader, dir record.DirectoryRecord, cur *Directory, hash uint32, idx int) error {
+	me := FromDirectoryRecord(h, dir, hash)
 	me.Path = cur.Path + me.Name + "/"
+	me.parent = cur
+	me.entry = idx
 	cur.Subfolders = append(cur.Subfolders, me)
 
-	for _, e := range dir.Entries {
-		if err := doEntry(f, e, me); err != nil {
+	for k, e := range dir.Entries {
+		if err := l.doEntry(e, me, k+1); err != nil {
 			return err
 		}
 	}
@@ -97,27 +118,44 @@ func doDir(f *os.File, h record.RecordHeader, cur *Directory, t uint32) error {
 	return nil
 }
 
-func doFile(f *os.File, h record.RecordHeader, cur *Directory, t uint32) error {
-	file, err := record.ReadFile(f, h)
-	if err != nil {
-		return err
-	}
-
-	me := FromFileRecord(h, file, t)
+func (l *loader) doFile(h record.RecordHeader, file record.FileRecord, cur *Directory, hash uint32, idx int) error {
+	me := FromFileRecord(h, file, hash)
 	me.Path = cur.Path + me.Name
+	me.entry = idx
 	cur.Files = append(cur.Files, me)
 	return nil
 }
 
-func doHeader(f *os.File, h record.RecordHeader, cur *Directory, t uint32) error {
-	switch h.Tag {
-	case "PDIR":
-		return doDir(f, h, cur, t)
-	case "FILE":
-		return doFile(f, h, cur, t)
-	case "FREE":
-	default:
-		log.Print("This record is unknown type")
+func (l *loader) doRecord(h record.RecordHeader, rec interface{}, cur *Directory, hash uint32, idx int) error {
+	switch r := rec.(type) {
+	case record.DirectoryRecord:
+		return l.doDir(h, r, cur, hash, idx)
+	case record.FileRecord:
+		return l.doFile(h, r, cur, hash, idx)
+	case record.FreeRecord, record.RawRecord:
+		return attach(l.f, h, rec, cur, hash, idx)
+	}
+	return nil
+}
+
+// attach adds free record or record of unknown type to cur as attachment
+func attach(f io.ReaderAt, h record.RecordHeader, rec interface{}, cur *Directory, hash uint32, idx int) error {
+	a, err := attachment(f, h, rec, hash, idx)
+	if err != nil {
+		return err
 	}
+	cur.Attachments = append(cur.Attachments, a)
 	return nil
 }
+
+// attachment creates Attachment of record rec, which is entry idx of its directory
+func attachment(f io.ReaderAt, h record.RecordHeader, rec interface{}, hash uint32, idx int) (*Attachment, error) {
+	raw, ok := rec.(record.RawRecord)
+	if !ok {
+		var err error
+		if raw, err = record.ReadRaw(f, h); err != nil {
+			return nil, err
+		}
+	}
+	return &Attachment{Hash: hash, Record: raw, entry: idx}, nil
+}
@@ -0,0 +1,38 @@
+package afs_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// synthetic builds ggpk file of dirs directories, each has files small files
+func synthetic(b *testing.B, dirs, files int) []byte {
+	tree := map[string]string{}
+	for d := 0; d < dirs; d++ {
+		for f := 0; f < files; f++ {
+			tree[fmt.Sprintf("Data/dir%d/sub%d/file%d.dat", d/10, d, f)] = fmt.Sprint(d, f)
+		}
+	}
+	return pack(b, newTree(b, tree), record.Version3)
+}
+
+func BenchmarkFromGGPK(b *testing.B) {
+	data := synthetic(b, 100, 100)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		root, err := afs.FromGGPK(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if len(root.Subfolders) != 1 {
+			b.Fatalf("expected 1 folder in root, got %d", len(root.Subfolders))
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package afs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Reader reads content of an afs file
+//
+// Reader never touches shared file offset of original file, so it is safe to
+// read different files, or same file through different Readers, concurrently.
+// ReadAt of a Reader can also be called concurrently. Reader implements fs.File.
+type Reader struct {
+	*io.SectionReader
+	file   *File
+	closer io.Closer // physic file opened by Open, nil if reading from ggpk file
+	sum    hash.Hash // nil if digest is not verified
+	hashed int64     // length of content already fed to sum
+}
+
+// Open opens file content for reading
+//
+// Digest is verified if the file is read from an archive wrapped by Verify,
+// see OpenVerified.
+func (f *File) Open() (*Reader, error) {
+	if _, ok := f.OrigFile.(verified); ok {
+		return f.OpenVerified()
+	}
+	return f.open()
+}
+
+// OpenVerified opens file content for reading, verifying digest while reading
+//
+// Content is hashed when reading through Read, and *DigestError is returned
+// instead of io.EOF if it does not match f.Digest. Seeking is allowed, parts
+// skipped are hashed at EOF. ReadAt is not verified.
+func (f *File) OpenVerified() (r *Reader, err error) {
+	if r, err = f.open(); err == nil {
+		r.sum = sha256.New()
+	}
+	return
+}
+
+// open opens content of f, files found by FromDirectory are opened only now
+func (f *File) open() (*Reader, error) {
+	src, closer := f.OrigFile, io.Closer(nil)
+	if p, ok := f.OrigFile.(diskFile); ok {
+		file, err := os.Open(string(p))
+		if err != nil {
+			return nil, err
+		}
+		src, closer = file, file
+	}
+	return &Reader{
+		SectionReader: io.NewSectionReader(src, int64(f.Offset), int64(f.Size)),
+		file:          f,
+		closer:        closer,
+	}, nil
+}
+
+// Read implements io.Reader
+func (r *Reader) Read(p []byte) (n int, err error) {
+	if r.sum == nil {
+		return r.SectionReader.Read(p)
+	}
+
+	pos, _ := r.Seek(0, io.SeekCurrent)
+	n, err = r.SectionReader.Read(p)
+	if end := pos + int64(n); pos <= r.hashed && end > r.hashed {
+		r.sum.Write(p[r.hashed-pos : n])
+		r.hashed = end
+	}
+	if err == io.EOF {
+		err = r.verify()
+	}
+	return
+}
+
+// Verify checks whole content against digest of the file, reading parts not read yet
+//
+// It returns *DigestError if content does not match. It also works with
+// Readers not opened by OpenVerified.
+func (r *Reader) Verify() error {
+	if r.sum == nil {
+		r.sum = sha256.New()
+		r.hashed = 0
+	}
+	if err := r.verify(); err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// verify returns io.EOF if content matches digest
+func (r *Reader) verify() error {
+	if rest := r.Size() - r.hashed; rest > 0 {
+		if _, err := io.Copy(r.sum, io.NewSectionReader(r.SectionReader, r.hashed, rest)); err != nil {
+			return err
+		}
+		r.hashed += rest
+	}
+
+	if sum := r.sum.Sum(nil); !bytes.Equal(sum, r.file.Digest) {
+		return &DigestError{Path: r.file.Path, Expected: r.file.Digest, Actual: sum}
+	}
+	return io.EOF
+}
+
+// Stat returns FileInfo describing the file
+func (r *Reader) Stat() (fs.FileInfo, error) {
+	return r.file.Info(), nil
+}
+
+// Close closes physic file opened by Open, ggpk file is not owned by the Reader
+func (r *Reader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
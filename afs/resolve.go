@@ -0,0 +1,121 @@
+package afs
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Resolution decides how Resolve matches path against names in afs
+type Resolution int
+
+const (
+	Exact      Resolution = iota // slash separated and case sensitive, same as Lookup
+	GameClient                   // slash or backslash separated and case insensitive, as the game does
+)
+
+// AmbiguousError reports a path matches more than one entry in GameClient resolution
+type AmbiguousError struct {
+	Path  string   // path being resolved
+	Dir   string   // Path of directory containing colliding entries
+	Names []string // names of colliding entries
+}
+
+func (e *AmbiguousError) Error() string {
+	return fmt.Sprintf("%s is ambiguous: %s matches %s", e.Path, e.Dir, strings.Join(e.Names, ", "))
+}
+
+// Normalize converts path to the form Lookup accepts: backslashes are
+// converted to slashes and empty elements are removed
+func Normalize(path string) string {
+	nodes := strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '\\' })
+	return strings.Join(nodes, "/")
+}
+
+// Resolve finds file or directory by path relative to d, using specified resolution
+//
+// In GameClient resolution, names are compared in lower case, like how name
+// hash is computed. *AmbiguousError is returned if more than one
+// entry in a directory matches the element case-insensitively.
+func (d *Directory) Resolve(path string, mode Resolution) (Node, error) {
+	if mode == Exact {
+		return d.Lookup(path)
+	}
+
+	norm := Normalize(path)
+	if norm == "" {
+		return d, nil
+	}
+
+	cur := d
+	nodes := strings.Split(norm, "/")
+	for idx, node := range nodes {
+		found, err := cur.fold(node)
+		if err != nil {
+			return nil, err
+		}
+
+		var dirs []*Directory
+		var names []string
+		var file *File
+		for _, n := range found {
+			switch x := n.(type) {
+			case *File:
+				if idx == len(nodes)-1 {
+					file = x
+					names = append(names, x.Name)
+				}
+			case *Directory:
+				dirs = append(dirs, x)
+				names = append(names, x.Name+"/")
+			}
+		}
+
+		switch len(names) {
+		case 0:
+			return nil, &NotFoundError{path, cur.Path, node}
+		case 1:
+		default:
+			return nil, &AmbiguousError{path, cur.Path, names}
+		}
+
+		if file != nil {
+			return file, nil
+		}
+		cur = dirs[0]
+	}
+	return cur, nil
+}
+
+// fold returns files and subfolders of d named name case-insensitively
+//
+// Only children with matching name hash are compared, unless none matches,
+// which is the case of ggpk files written by older version of defrag.
+// Directories not loaded yet are searched by name hash without loading.
+func (d *Directory) fold(name string) ([]Node, error) {
+	if !d.Loaded() {
+		ret, ok, err := d.findFold(name)
+		if ok || err != nil {
+			return ret, err
+		}
+	}
+
+	hash := d.version.Hash(name)
+	lower := strings.ToLower(name)
+	var ret []Node
+	for _, all := range []bool{false, true} {
+		for _, f := range d.Files {
+			if (all || f.Hash == hash) && strings.ToLower(f.Name) == lower {
+				ret = append(ret, f)
+			}
+		}
+		for _, sub := range d.Subfolders {
+			if (all || sub.Hash == hash) && strings.ToLower(sub.Name) == lower {
+				ret = append(ret, sub)
+			}
+		}
+		if len(ret) > 0 {
+			break
+		}
+	}
+	return ret, nil
+}
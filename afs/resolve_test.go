@@ -0,0 +1,65 @@
+package afs_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+var resolveTree = map[string]string{
+	"Data/Mods.dat":        "mods",
+	"Data/Sub/中文.txt":      "cjk",
+	"Data/Sub/Other.txt":   "other",
+	"Art/icon.dds":         "icon",
+	"Art/ICON.dds":         "ICON",
+	"Metadata/Items/a.ot":  "a",
+	"Metadata/items/b.ot":  "b",
+	"Metadata/Items2/c.ot": "c",
+}
+
+func TestResolveGameClient(t *testing.T) {
+	data := pack(t, newTree(t, resolveTree), record.Version3)
+	eager, err := afs.FromGGPK(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lazy, err := afs.FromGGPKLazy(bytes.NewReader(data), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, root := range map[string]*afs.Directory{"eager": eager, "lazy": lazy, "new": newTree(t, resolveTree)} {
+		n, err := root.Resolve(`data\SUB\中文.TXT`, afs.GameClient)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if f, ok := n.(*afs.File); !ok || f.Path != "/Data/Sub/中文.txt" {
+			t.Errorf("%s: resolved to %v", name, n.Info().Name())
+		}
+
+		if _, err = root.Resolve("data/missing.dat", afs.GameClient); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("%s: expected not found, got %v", name, err)
+		}
+
+		var ambiguous *afs.AmbiguousError
+		if _, err = root.Resolve("art/Icon.dds", afs.GameClient); !errors.As(err, &ambiguous) || len(ambiguous.Names) != 2 {
+			t.Errorf("%s: expected ambiguous error, got %v", name, err)
+		}
+		if _, err = root.Resolve("metadata/items", afs.GameClient); !errors.As(err, &ambiguous) {
+			t.Errorf("%s: expected ambiguous error, got %v", name, err)
+		}
+	}
+
+	// lazily loaded directories are searched by name hash, not loaded
+	sub, err := lazy.LookupDir("Data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sub.Loaded() {
+		t.Error("directory is loaded when resolving path")
+	}
+}
@@ -3,9 +3,10 @@ package afs
 
 import (
 	"crypto/sha256"
-	"encoding/binary"
+	"io"
 	"io/ioutil"
 	"os"
+	"sort"
 	"time"
 
 	"github.com/Patrolavia/ggpk/record"
@@ -15,23 +16,25 @@ import (
 type File struct {
 	Path      string
 	Name      string
-	Timestamp uint32
+	Timestamp uint32 // modification time of physic file, ggpk does not store it
+	Hash      uint32 // name hash stored in ggpk file, see record.Version.Hash
 	Digest    []byte
 	Size      uint64
 	Offset    uint64
-	OrigFile  *os.File
+	OrigFile  io.ReaderAt
+	entry     int // position in directory record of ggpk file, starts from 1, 0 if not read from ggpk
 }
 
 // FromFileRecord creates File from ggpk record readed from ggpk file
-func FromFileRecord(h record.RecordHeader, f record.FileRecord, t uint32) *File {
+func FromFileRecord(h record.RecordHeader, f record.FileRecord, hash uint32) *File {
 	return &File{
-		Path:      "",
-		Name:      f.Name,
-		Timestamp: t,
-		Digest:    f.Digest,
-		Size:      uint64(h.Length) - uint64(h.ByteLength()+f.ByteLength()),
-		Offset:    h.Offset + uint64(f.ByteLength()),
-		OrigFile:  f.OrigFile,
+		Path:     "",
+		Name:     f.Name,
+		Hash:     hash,
+		Digest:   f.Digest,
+		Size:     uint64(h.Length) - uint64(h.ByteLength()+f.ByteLength()),
+		Offset:   h.Offset + uint64(f.ByteLength()),
+		OrigFile: f.OrigFile,
 	}
 }
 
@@ -42,11 +45,7 @@ func FromFile(f *os.File) (ret *File, err error) {
 		return
 	}
 
-	if _, err = f.Seek(0, 0); err != nil {
-		return
-	}
-
-	data, err := ioutil.ReadAll(f)
+	data, err := ioutil.ReadAll(io.NewSectionReader(f, 0, info.Size()))
 	if err != nil {
 		return
 	}
@@ -68,70 +67,170 @@ func FromFile(f *os.File) (ret *File, err error) {
 	return
 }
 
-// Content reads file content from original file or ggpk file
+// Content reads whole file content from original file or ggpk file
 func (f *File) Content() (data []byte, err error) {
-	if _, err = f.OrigFile.Seek(int64(f.Offset), 0); err != nil {
+	r, err := f.Open()
+	if err != nil {
 		return
 	}
+	defer r.Close()
 
 	data = make([]byte, f.Size)
-	err = binary.Read(f.OrigFile, binary.LittleEndian, data)
+	if _, err = io.ReadFull(r, data); err != nil {
+		return
+	}
+
+	// ReadFull stops before EOF, which is where digest is verified
+	if r.sum != nil {
+		err = r.Verify()
+	}
 	return
 }
 
+// Attachment is a record of unknown type or free record found in a
+// directory, which is kept as is so it can be written back
+type Attachment struct {
+	Hash   uint32 // name hash stored in directory entry
+	Record record.RawRecord
+	entry  int // see File
+}
+
 // Directory represents virtual directory
 type Directory struct {
-	Path       string
-	Name       string
-	Timestamp  uint32
-	digest     []byte
-	Subfolders []*Directory
-	Files      []*File
-	Offset     uint64
+	Path        string
+	Name        string
+	Timestamp   uint32 // creation time of afs root, ggpk does not store it
+	Hash        uint32 // name hash stored in ggpk file, see record.Version.Hash
+	digest      []byte // cached result of Digest
+	stored      []byte // digest stored in ggpk file
+	Subfolders  []*Directory
+	Files       []*File
+	Attachments []*Attachment
+	Offset      uint64
+	parent      *Directory     // nil for root
+	lazy        *lazy          // nil if not loaded by FromGGPKLazy
+	entry       int            // see File
+	version     record.Version // order of entries used by Digest, Version3 if not read from ggpk
 }
 
 // Root creates empty root record
 func Root() *Directory {
 	return &Directory{
-		Path:       "",
-		Name:       "",
-		Timestamp:  uint32(time.Now().Unix()),
-		digest:     make([]byte, 0),
-		Subfolders: make([]*Directory, 0),
-		Files:      make([]*File, 0),
-		Offset:     0,
+		Path:        "",
+		Name:        "",
+		Timestamp:   uint32(time.Now().Unix()),
+		digest:      make([]byte, 0),
+		Subfolders:  make([]*Directory, 0),
+		Files:       make([]*File, 0),
+		Attachments: make([]*Attachment, 0),
+		Offset:      0,
+		version:     record.Version3,
 	}
 }
 
 // FromDirectoryRecord creates Directory from ggpk record
-func FromDirectoryRecord(h record.RecordHeader, d record.DirectoryRecord, t uint32) *Directory {
-	return &Directory{
-		Path:       "",
-		Name:       d.Name,
-		Timestamp:  t,
-		digest:     make([]byte, 0), // reset digest because afs would not preserve original order
-		Subfolders: make([]*Directory, 0),
-		Files:      make([]*File, 0),
-		Offset:     h.Offset,
+func FromDirectoryRecord(h record.RecordHeader, d record.DirectoryRecord, hash uint32) *Directory {
+	ret := &Directory{
+		Path:        "",
+		Name:        d.Name,
+		Hash:        hash,
+		stored:      d.Digest,
+		Subfolders:  make([]*Directory, 0),
+		Files:       make([]*File, 0),
+		Attachments: make([]*Attachment, 0),
+		Offset:      h.Offset,
+		version:     d.Version,
+	}
+	if d.Sorted() {
+		ret.digest = d.Digest
 	}
+	return ret
 }
 
-// Digest compute directory content digeset
+// Digest computes directory content digest
+//
+// It is sha256 of digests of files and subfolders, in the order returned by
+// Entries, which is also the order written by package generate. Digest
+// stored in ggpk file is used until d is edited, if entries of the directory
+// record are sorted that way, see StoredDigest. Lazily loaded directory is
+// loaded first, stored digest is returned if it cannot be loaded.
 func (d *Directory) Digest() []byte {
 	if len(d.digest) == 32 {
 		return d.digest
 	}
+	if err := d.Load(); err != nil {
+		return d.stored
+	}
 
-	data := make([]byte, 0)
+	sum := sha256.New()
+	for _, e := range d.Entries(d.version, false) {
+		switch x := e.Node.(type) {
+		case *File:
+			sum.Write(x.Digest)
+		case *Directory:
+			sum.Write(x.Digest())
+		}
+	}
+	d.digest = sum.Sum(nil)
+	return d.digest
+}
+
+// StoredDigest returns digest of d stored in ggpk file, nil if d is not read from ggpk file
+func (d *Directory) StoredDigest() []byte {
+	return d.stored
+}
+
+// Entry is a child of directory, as listed in directory record of ggpk file
+type Entry struct {
+	Hash       uint32      // name hash, see record.Version.Hash
+	Node       Node        // *File or *Directory, nil for attachment
+	Attachment *Attachment // nil for files and subfolders
+}
+
+// Entries returns files and subfolders of d, and attachments if asked, in
+// the order of directory record of ggpk file version v
+//
+// Like the game, entries are sorted by name hash. Same hashes are ordered by
+// position in directory record read from ggpk file, those not read from ggpk
+// file come last, ordered by name. Attachments use hash stored in ggpk file.
+func (d *Directory) Entries(v record.Version, attachments bool) []Entry {
+	type child struct {
+		Entry
+		entry int
+		name  string
+	}
+	children := make([]child, 0, len(d.Files)+len(d.Subfolders)+len(d.Attachments))
 	for _, f := range d.Files {
-		data = append(data, f.Digest...)
+		children = append(children, child{Entry{v.Hash(f.Name), f, nil}, f.entry, f.Name})
 	}
-	for _, f := range d.Subfolders {
-		data = append(data, f.Digest()...)
+	for _, sub := range d.Subfolders {
+		children = append(children, child{Entry{v.Hash(sub.Name), sub, nil}, sub.entry, sub.Name})
 	}
-	sum := sha256.Sum256(data)
-	d.digest = sum[0:]
-	return d.digest
+	if attachments {
+		for _, a := range d.Attachments {
+			children = append(children, child{Entry{a.Hash, nil, a}, a.entry, ""})
+		}
+	}
+
+	sort.SliceStable(children, func(i, j int) bool {
+		a, b := children[i], children[j]
+		if a.Hash != b.Hash {
+			return a.Hash < b.Hash
+		}
+		if (a.entry == 0) != (b.entry == 0) {
+			return b.entry == 0
+		}
+		if a.entry != b.entry {
+			return a.entry < b.entry
+		}
+		return a.name < b.name
+	})
+
+	ret := make([]Entry, len(children))
+	for k, c := range children {
+		ret[k] = c.Entry
+	}
+	return ret
 }
 
 // ByName can sort files by filename
@@ -0,0 +1,80 @@
+package afs_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+var digestTree = map[string]string{
+	"a.txt":              "a",
+	"B.txt":              "b",
+	"中文.txt":             "c",
+	"𝄞😀.ogg":             "d",
+	"Data/x.dat":         "x",
+	"Data/Y.dat":         "y",
+	"Data/sub/z.dat":     "z",
+	"Art/2DArt/icon.dds": "icon",
+}
+
+func TestDigestOfWritten(t *testing.T) {
+	tree := newTree(t, digestTree)
+	want := tree.Digest()
+
+	root, err := afs.FromGGPK(bytes.NewReader(pack(t, tree, record.Version3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := root.StoredDigest(); !bytes.Equal(got, want) {
+		t.Errorf("stored digest is %x, expected %x", got, want)
+	}
+	if got := root.Digest(); !bytes.Equal(got, want) {
+		t.Errorf("digest is %x, expected %x", got, want)
+	}
+}
+
+func TestDigestOfEdited(t *testing.T) {
+	root, err := afs.FromGGPK(bytes.NewReader(pack(t, newTree(t, digestTree), record.Version3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := root.LookupDir("Data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = data.AddFile(newFile("new.dat", "new")); err != nil {
+		t.Fatal(err)
+	}
+	if err = root.Rename("a.txt", data, "renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	want := root.Digest()
+
+	again, err := afs.FromGGPK(bytes.NewReader(pack(t, root, record.Version3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := again.Digest(); !bytes.Equal(got, want) {
+		t.Errorf("digest of written file is %x, expected %x", got, want)
+	}
+}
+
+func TestEntriesOrder(t *testing.T) {
+	tree := newTree(t, digestTree)
+	for _, v := range []record.Version{record.Version3, record.Version4} {
+		entries := tree.Entries(v, true)
+		if len(entries) != 6 {
+			t.Fatalf("expected 6 entries, got %d", len(entries))
+		}
+		for k, e := range entries {
+			if h := v.Hash(e.Node.Info().Name()); h != e.Hash {
+				t.Errorf("v%d: hash of entry %d is %x, expected %x", v, k, e.Hash, h)
+			}
+			if k > 0 && entries[k-1].Hash > e.Hash {
+				t.Errorf("v%d: entries are not sorted by hash", v)
+			}
+		}
+	}
+}
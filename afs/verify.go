@@ -0,0 +1,51 @@
+package afs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// ErrDigestMismatch means file content does not match its digest
+var ErrDigestMismatch = errors.New("digest mismatch")
+
+// DigestError reports a file which content does not match its digest
+type DigestError struct {
+	Path     string
+	Expected []byte // digest stored in ggpk file
+	Actual   []byte // digest of content
+}
+
+func (e *DigestError) Error() string {
+	return fmt.Sprintf("digest of %s mismatch: %x stored, %x computed", e.Path, e.Expected, e.Actual)
+}
+
+// Unwrap makes errors.Is(err, ErrDigestMismatch) work
+func (e *DigestError) Unwrap() error {
+	return ErrDigestMismatch
+}
+
+// Verify wraps ggpk file, so every file of afs built from it verifies digest when opened
+//
+//	root, err := afs.FromGGPK(afs.Verify(f))
+//
+// Content, Open and fs.FS methods of such files return *DigestError on
+// corrupted content, see File.OpenVerified.
+func Verify(f io.ReaderAt) io.ReaderAt {
+	if _, ok := f.(verified); ok {
+		return f
+	}
+	return verified{f}
+}
+
+// verified marks ggpk file wrapped by Verify
+type verified struct {
+	io.ReaderAt
+}
+
+// Size keeps records in verified file validated cheaply, see record.Size
+func (v verified) Size() int64 {
+	return record.Size(v.ReaderAt)
+}
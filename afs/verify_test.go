@@ -0,0 +1,81 @@
+package afs_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+// corrupted returns archive which content of /Data/Mods.dat is damaged
+func corrupted(t *testing.T) []byte {
+	data := pack(t, newTree(t, map[string]string{
+		"Data/Mods.dat": "hello",
+		"a.txt":         "world",
+	}), record.Version3)
+	idx := bytes.Index(data, []byte("hello"))
+	if idx < 0 {
+		t.Fatal("cannot find content of Mods.dat")
+	}
+	data[idx] ^= 0xff
+	return data
+}
+
+func TestVerifiedContent(t *testing.T) {
+	root, err := afs.FromGGPK(afs.Verify(bytes.NewReader(corrupted(t))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := root.LookupFile("Data/Mods.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := f.Content(); !errors.Is(err, afs.ErrDigestMismatch) {
+		t.Errorf("Content: expected digest mismatch, got %v", err)
+	}
+	if _, err := fs.ReadFile(root, "Data/Mods.dat"); !errors.Is(err, afs.ErrDigestMismatch) {
+		t.Errorf("ReadFile: expected digest mismatch, got %v", err)
+	}
+	r, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, afs.ErrDigestMismatch) {
+		t.Errorf("ReadAll: expected digest mismatch, got %v", err)
+	}
+
+	good, err := root.LookupFile("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := good.Content(); err != nil || string(data) != "world" {
+		t.Errorf("Content of intact file: %q, %v", data, err)
+	}
+}
+
+func TestUnverifiedContent(t *testing.T) {
+	root, err := afs.FromGGPK(bytes.NewReader(corrupted(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := root.LookupFile("Data/Mods.dat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Content(); err != nil {
+		t.Errorf("Content without Verify: %v", err)
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Verify(); !errors.Is(err, afs.ErrDigestMismatch) {
+		t.Errorf("Verify: expected digest mismatch, got %v", err)
+	}
+}
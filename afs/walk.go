@@ -0,0 +1,231 @@
+package afs
+
+import (
+	"errors"
+	"io/fs"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+// WalkFunc is called by Walk for every directory and file, n is *Directory or *File
+//
+// Returning fs.SkipDir when visiting a directory skips its content, when
+// visiting a file skips remaining files and subfolders of the directory
+// containing it. Returning fs.SkipAll stops walking, and Walk returns nil.
+// Other errors stop walking, and are returned by Walk.
+type WalkFunc func(n Node) error
+
+// Walk visits d and everything inside it, a directory is visited before its
+// files, then its subfolders
+//
+// Lazily loaded directories are loaded before visited, failing to load stops
+// walking, and the error is returned.
+func (d *Directory) Walk(fn WalkFunc) error {
+	err := d.walk(fn, map[*Directory]bool{})
+	if err == fs.SkipDir || err == fs.SkipAll {
+		err = nil
+	}
+	return err
+}
+
+// walk visits d recursively, seen holds directories visited to detect loop
+func (d *Directory) walk(fn WalkFunc, seen map[*Directory]bool) error {
+	if seen[d] {
+		return &fs.PathError{Op: "walk", Path: d.Path, Err: errLoop}
+	}
+	seen[d] = true
+
+	if err := d.Load(); err != nil {
+		return err
+	}
+	if err := fn(d); err != nil {
+		if err == fs.SkipDir {
+			return nil
+		}
+		return err
+	}
+
+	for _, f := range d.Files {
+		if err := fn(f); err != nil {
+			if err == fs.SkipDir {
+				return nil
+			}
+			return err
+		}
+	}
+	for _, sub := range d.Subfolders {
+		if err := sub.walk(fn, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// errLoop reports a directory found inside itself
+var errLoop = errors.New("directory contains itself")
+
+// Order decides in which order directories are iterated
+type Order int
+
+const (
+	DepthFirst   Order = iota // a directory is followed by its subfolders
+	BreadthFirst              // all directories in one level, then next level
+)
+
+// Dirs iterates d and all directories inside it
+//
+// Lazily loaded directories are loaded before yielded. Iteration stops at the
+// first one failing to load, and err returns the error after iteration.
+func (d *Directory) Dirs(order Order) (seq iter.Seq[*Directory], err func() error) {
+	var failed error
+	load := func(cur *Directory) bool {
+		if e := cur.Load(); e != nil {
+			failed = e
+			return false
+		}
+		return true
+	}
+	err = func() error { return failed }
+
+	if order == BreadthFirst {
+		seq = func(yield func(*Directory) bool) {
+			for queue := []*Directory{d}; len(queue) > 0; queue = queue[1:] {
+				cur := queue[0]
+				if !load(cur) || !yield(cur) {
+					return
+				}
+				queue = append(queue, cur.Subfolders...)
+			}
+		}
+		return
+	}
+
+	seq = func(yield func(*Directory) bool) {
+		var visit func(cur *Directory) bool
+		visit = func(cur *Directory) bool {
+			if !load(cur) || !yield(cur) {
+				return false
+			}
+			for _, sub := range cur.Subfolders {
+				if !visit(sub) {
+					return false
+				}
+			}
+			return true
+		}
+		visit(d)
+	}
+	return
+}
+
+// AllFiles iterates files inside d recursively, with their paths
+//
+// Files of a directory are iterated together, directories are in the order
+// of Dirs. err returns the error stopped iteration, see Dirs.
+func (d *Directory) AllFiles(order Order) (seq iter.Seq2[string, *File], err func() error) {
+	dirs, err := d.Dirs(order)
+	seq = func(yield func(string, *File) bool) {
+		for dir := range dirs {
+			for _, f := range dir.Files {
+				if !yield(f.Path, f) {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// WalkParallel is Walk, but subfolders are visited concurrently, by at most
+// workers goroutines
+//
+// fn must be safe for concurrent use. Order of visiting is not defined,
+// except a directory is visited before its content. First error stops
+// walking, but fn might still be called by other goroutines before
+// WalkParallel returns.
+func (d *Directory) WalkParallel(workers int, fn WalkFunc) error {
+	if workers < 1 {
+		workers = 1
+	}
+	p := &parallel{fn: fn, sem: make(chan struct{}, workers-1), seen: map[*Directory]bool{}}
+	p.visit(d)
+	p.wg.Wait()
+
+	if err, _ := p.err.Load().(error); err != nil && !errors.Is(err, fs.SkipAll) {
+		return err
+	}
+	return nil
+}
+
+// parallel holds states of WalkParallel
+type parallel struct {
+	fn   WalkFunc
+	sem  chan struct{} // tokens for additional goroutines
+	wg   sync.WaitGroup
+	err  atomic.Value // first error returned by fn
+	once sync.Once
+	stop atomic.Bool
+	mu   sync.Mutex
+	seen map[*Directory]bool // directories visited, to detect loop
+}
+
+func (p *parallel) fail(err error) {
+	p.once.Do(func() {
+		p.err.Store(err)
+		p.stop.Store(true)
+	})
+}
+
+func (p *parallel) visit(d *Directory) {
+	if p.stop.Load() {
+		return
+	}
+	p.mu.Lock()
+	loop := p.seen[d]
+	p.seen[d] = true
+	p.mu.Unlock()
+	if loop {
+		p.fail(&fs.PathError{Op: "walk", Path: d.Path, Err: errLoop})
+		return
+	}
+
+	if err := d.Load(); err != nil {
+		p.fail(err)
+		return
+	}
+	if err := p.fn(d); err != nil {
+		if err != fs.SkipDir {
+			p.fail(err)
+		}
+		return
+	}
+
+	for _, f := range d.Files {
+		if p.stop.Load() {
+			return
+		}
+		if err := p.fn(f); err != nil {
+			if err != fs.SkipDir {
+				p.fail(err)
+			}
+			return
+		}
+	}
+
+	for _, sub := range d.Subfolders {
+		select {
+		case p.sem <- struct{}{}:
+			p.wg.Add(1)
+			go func(sub *Directory) {
+				defer func() {
+					<-p.sem
+					p.wg.Done()
+				}()
+				p.visit(sub)
+			}(sub)
+		default:
+			p.visit(sub)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package afs_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Patrolavia/ggpk/afs"
+	"github.com/Patrolavia/ggpk/record"
+)
+
+var walkTree = map[string]string{
+	"a.txt":            "a",
+	"Data/x.dat":       "x",
+	"Data/y.dat":       "y",
+	"Data/Sub/z.dat":   "z",
+	"Art/2DArt/i.dds":  "i",
+	"Art/2DArt/j.dds":  "j",
+	"Art/Textures/k.d": "k",
+}
+
+// counts returns how many files each directory has, as "path:count", sorted
+func counts(dirs []*afs.Directory) string {
+	ret := make([]string, len(dirs))
+	for k, d := range dirs {
+		ret[k] = fmt.Sprintf("%s:%d", d.Path, len(d.Files))
+	}
+	sort.Strings(ret)
+	return strings.Join(ret, ",")
+}
+
+const walkCounts = "/:1,/Art/2DArt/:2,/Art/:0,/Art/Textures/:1,/Data/:2,/Data/Sub/:1"
+
+func lazyTree(t *testing.T) *afs.Directory {
+	root, err := afs.FromGGPKLazy(bytes.NewReader(pack(t, newTree(t, walkTree), record.Version3)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestWalkLazy(t *testing.T) {
+	var dirs []*afs.Directory
+	files := 0
+	err := lazyTree(t).Walk(func(n afs.Node) error {
+		switch x := n.(type) {
+		case *afs.Directory:
+			dirs = append(dirs, x)
+		case *afs.File:
+			files++
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counts(dirs); got != walkCounts {
+		t.Errorf("Walk: %s", got)
+	}
+	if files != len(walkTree) {
+		t.Errorf("Walk: %d files visited, expected %d", files, len(walkTree))
+	}
+
+	var mu sync.Mutex
+	dirs = dirs[:0]
+	err = lazyTree(t).WalkParallel(4, func(n afs.Node) error {
+		if d, ok := n.(*afs.Directory); ok {
+			mu.Lock()
+			dirs = append(dirs, d)
+			mu.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := counts(dirs); got != walkCounts {
+		t.Errorf("WalkParallel: %s", got)
+	}
+}
+
+func TestDirsLazy(t *testing.T) {
+	for _, order := range []afs.Order{afs.DepthFirst, afs.BreadthFirst} {
+		seq, errf := lazyTree(t).Dirs(order)
+		var dirs []*afs.Directory
+		for d := range seq {
+			dirs = append(dirs, d)
+		}
+		if err := errf(); err != nil {
+			t.Fatal(err)
+		}
+		if got := counts(dirs); got != walkCounts {
+			t.Errorf("Dirs(%d): %s", order, got)
+		}
+
+		files, errf := lazyTree(t).AllFiles(order)
+		n := 0
+		for p, f := range files {
+			if p != f.Path {
+				t.Errorf("AllFiles(%d): path %s of file %s", order, p, f.Path)
+			}
+			n++
+		}
+		if err := errf(); err != nil {
+			t.Fatal(err)
+		}
+		if n != len(walkTree) {
+			t.Errorf("AllFiles(%d): %d files, expected %d", order, n, len(walkTree))
+		}
+	}
+}
+
+func TestWalkLoadError(t *testing.T) {
+	data := pack(t, newTree(t, walkTree), record.Version3)
+	breakEntry(t, data, 0)
+	open := func() *afs.Directory {
+		root, err := afs.FromGGPKLazy(bytes.NewReader(data), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return root
+	}
+
+	var corrupt *record.CorruptError
+	visited := 0
+	if err := open().Walk(func(afs.Node) error { visited++; return nil }); !errors.As(err, &corrupt) || visited != 0 {
+		t.Errorf("Walk: expected CorruptError before visiting, got %v after %d nodes", err, visited)
+	}
+	if err := open().WalkParallel(2, func(afs.Node) error { return nil }); !errors.As(err, &corrupt) {
+		t.Errorf("WalkParallel: expected CorruptError, got %v", err)
+	}
+
+	seq, errf := open().Dirs(afs.BreadthFirst)
+	for range seq {
+		t.Error("directory failing to load is yielded")
+	}
+	if err := errf(); !errors.As(err, &corrupt) {
+		t.Errorf("Dirs: expected CorruptError, got %v", err)
+	}
+	files, errf := open().AllFiles(afs.DepthFirst)
+	for range files {
+		t.Error("file of directory failing to load is yielded")
+	}
+	if err := errf(); !errors.As(err, &corrupt) {
+		t.Errorf("AllFiles: expected CorruptError, got %v", err)
+	}
+}
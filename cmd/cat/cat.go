@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"os"
+
+	"github.com/Patrolavia/ggpk/afs"
+)
+
+var (
+	fold    bool
+	verify  bool
+	nocache bool
+)
+
+func init() {
+	flag.BoolVar(&fold, "i", false, "Resolve path like game client: case insensitive, backslash is also separator.")
+	flag.BoolVar(&verify, "verify", false, "Verify digest of files, stop on corrupted file.")
+	flag.BoolVar(&nocache, "nocache", false, "Parse whole ggpk file instead of using cached index.")
+}
+
+func main() {
+	flag.Parse()
+	fn := flag.Arg(0)
+	paths := flag.Args()
+	if len(paths) < 2 {
+		log.Fatal("You have to specify path of files to print.")
+	}
+	paths = paths[1:]
+
+	f, err := os.Open(fn)
+	if err != nil {
+		log.Fatalf("Cannot open ggpk file at %s: %s", fn, err)
+	}
+	defer f.Close()
+
+	var archive io.ReaderAt = f
+	if verify {
+		archive = afs.Verify(f)
+	}
+
+	load := afs.FromGGPKCached
+	if nocache {
+		load = afs.FromGGPK
+	}
+	root, err := load(archive)
+	if err != nil {
+		log.Fatalf("Parse error: %s", err)
+	}
+
+	mode := afs.Exact
+	if fold {
+		mode = afs.GameClient
+	}
+	for _, path := range paths {
+		node, err := root.Resolve(path, mode)
+		if err != nil {
+			log.Fatalf("Cannot find %s: %s", path, err)
+		}
+		file, ok := node.(*afs.File)
+		if !ok {
+			log.Fatalf("%s is a directory", path)
+		}
+
+		r, err := file.Open()
+		if err != nil {
+			log.Fatalf("While reading file %s: %s", file.Path, err)
+		}
+		if _, err := io.Copy(os.Stdout, r); err != nil {
+			log.Fatalf("Cannot write content of %s: %s", file.Path, err)
+		}
+		r.Close()
+	}
+}
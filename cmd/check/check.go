@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 
@@ -15,10 +16,15 @@ func fatal(i interface{}) {
 	log.Fatal("[ERROR] ", i)
 }
 
-func fatalf(s string, args... interface{}) {
-	log.Fatalf("[ERROR] " + s, args...)
+func fatalf(s string, args ...interface{}) {
+	log.Fatalf("[ERROR] "+s, args...)
 }
 
+var (
+	version = record.Version(0) // version of ggpk file being checked
+	seen    = map[uint64]bool{} // records already checked, to detect loop
+)
+
 func main() {
 	flag.Parse()
 	fn := flag.Arg(0)
@@ -28,37 +34,41 @@ func main() {
 	}
 	defer f.Close()
 
-	rootNode, err := record.GGG(f)
+	info, err := f.Stat()
 	if err != nil {
-		fatalf("Cannot read ggpk signature: %s", err)
+		fatalf("Cannot stat ggpk file %s: %s", fn, err)
 	}
+	r := io.NewSectionReader(f, 0, info.Size())
 
-	if rootNode.Header.Tag != "GGPK" {
-		fatal("This file is not ggpk file, or corrupted.")
+	rootNode, err := record.GGG(r)
+	if err != nil {
+		fatalf("Cannot read ggpk signature: %s", err)
 	}
 
-	nodes, err := rootNode.Children(f)
+	version = rootNode.Version
+
+	nodes, err := rootNode.Children(r)
 	if err != nil {
 		fatalf("Cannot read root node from ggpk: %s", err)
 	}
 
 	log.Print("Checking ...")
 	for _, node := range nodes {
-		doHeader(node, f, "")
+		doHeader(node, r, "", nil)
 	}
 	log.Print("All ok.")
 }
 
-func doHeader(h record.RecordHeader, f *os.File, path string) (ret []byte) {
+func doHeader(h record.RecordHeader, f io.ReaderAt, path string, e *record.DirectoryEntry) (ret []byte) {
 	switch h.Tag {
 	case "PDIR":
-		ret = doDir(h, f, path)
+		ret = doDir(h, f, path, e)
 	case "FILE":
-		ret = doFile(h, f, path)
+		ret = doFile(h, f, path, e)
 	case "FREE":
 		fmt.Println("Skip free space.")
 	default:
-		fatalf("Unknown record type %s", h.Tag)
+		fmt.Printf("Skip unknown record %q at %d.\n", h.Tag, h.Start())
 	}
 	return ret
 }
@@ -69,6 +79,11 @@ func b(path string, digest []byte) {
 
 func c(digest []byte, data []byte) {
 	sum := sha256.Sum256(data)
+	same(digest, sum[:])
+}
+
+// same ensures digest matches computed sum, exits otherwise
+func same(digest, sum []byte) {
 	for k, v := range digest {
 		if k >= len(sum) || v != sum[k] {
 			fmt.Printf("%x\n", sum)
@@ -78,26 +93,43 @@ func c(digest []byte, data []byte) {
 	fmt.Println("ok.")
 }
 
-func doFile(h record.RecordHeader, f *os.File, path string) []byte {
-	r, err := record.ReadFile(f, h)
+// verifyHash ensures name hash stored in directory entry e is correct, e is nil for root nodes
+func verifyHash(e *record.DirectoryEntry, path, name string) {
+	if e == nil {
+		return
+	}
+	if hash := version.Hash(name); hash != e.Hash {
+		fatalf("Name hash of %s mismatch: %08x stored, %08x expected", path, e.Hash, hash)
+	}
+}
+
+func doFile(h record.RecordHeader, f io.ReaderAt, path string, e *record.DirectoryEntry) []byte {
+	r, err := record.ReadFile(f, h, version)
 	if err != nil {
 		fatalf("Cannot read file in %s: %s", path, err)
 	}
 
 	fn := path + r.Name
+	verifyHash(e, fn, r.Name)
 	b(fn, r.Digest)
 	af := afs.FromFileRecord(h, r, 0)
-	data, err := af.Content()
+	rd, err := af.Open()
 	if err != nil {
+		fatalf("Cannot open %s: %s", fn, err)
+	}
+	defer rd.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, rd); err != nil {
 		fmt.Printf("%s\n", err)
 		os.Exit(1)
 	}
-	c(r.Digest, data)
+	same(r.Digest, hash.Sum(nil))
 	return r.Digest
 }
 
-func doDir(h record.RecordHeader, f *os.File, path string) []byte {
-	r, err := record.ReadDir(f, h)
+func doDir(h record.RecordHeader, f io.ReaderAt, path string, e *record.DirectoryEntry) []byte {
+	r, err := record.ReadDir(f, h, version)
 	if err != nil {
 		if path == "" {
 			path = "ROOT"
@@ -106,6 +138,7 @@ func doDir(h record.RecordHeader, f *os.File, path string) []byte {
 	}
 
 	fn := path + r.Name + "/"
+	verifyHash(e, fn, r.Name)
 	data := make([]byte, 0)
 	for _, e := range r.Entries {
 		data = append(data, doEntry(e, f, fn)...)
@@ -115,14 +148,14 @@ func doDir(h record.RecordHeader, f *os.File, path string) []byte {
 	return r.Digest
 }
 
-func doEntry(e record.DirectoryEntry, f *os.File, path string) []byte {
-	if _, err := f.Seek(int64(e.Offset), 0); err != nil {
-		fatalf("Cannot seek to %d: %s", e.Offset, err)
-	}
-	h, err := record.Header(f)
+func doEntry(e record.DirectoryEntry, f io.ReaderAt, path string) []byte {
+	h, err := record.Header(f, e.Offset)
 	if err != nil {
 		fatalf("Cannot read header from %d: %s", e.Offset, err)
 	}
-	h.Offset = e.Offset + uint64(h.ByteLength())
-	return doHeader(h, f, path)
+	if seen[e.Offset] {
+		fatalf("Record at %d in %s is referenced more than once", e.Offset, path)
+	}
+	seen[e.Offset] = true
+	return doHeader(h, f, path, &e)
 }
@@ -3,17 +3,40 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"log"
 	"os"
+	"strings"
 
 	"github.com/Patrolavia/ggpk/afs"
 	"github.com/Patrolavia/ggpk/generate"
 	"github.com/Patrolavia/ggpk/record"
 )
 
+var (
+	version  uint
+	drop     bool
+	verify   bool
+	nocache  bool
+	overlays multi
+)
+
+func init() {
+	flag.UintVar(&version, "v", 0, "Write result.ggpk as ggpk version `N`, 0 to keep version of original file (version 1 written by older defrag is kept as 3).")
+	flag.BoolVar(&drop, "drop", false, "Drop unknown and free records found in directories instead of preserving them.")
+	flag.BoolVar(&verify, "verify", false, "Verify digest of files while copying, stop on corrupted file.")
+	flag.BoolVar(&nocache, "nocache", false, "Parse whole ggpk file instead of using cached index.")
+	flag.Var(&overlays, "overlay", "Layer directory `D` over ggpk file, can be repeated. Files or directories named .wh.NAME delete NAME.")
+}
+
 func main() {
 	flag.Parse()
 	fn := flag.Arg(0)
 
+	if version != 0 && !record.Version(version).Supported() {
+		log.Fatalf("Unsupported ggpk version %d, should be 2, 3 or 4.", version)
+	}
+
 	done := func(err error) {
 		if err != nil {
 			fmt.Print(err)
@@ -27,8 +50,28 @@ func main() {
 	done(err)
 
 	fmt.Print("Reading GGPK content ... ")
-	root, err := afs.FromGGPK(orig)
+	origNode, err := record.GGG(orig)
+	if err != nil {
+		done(err)
+	}
+	var archive io.ReaderAt = orig
+	if verify {
+		archive = afs.Verify(orig)
+	}
+	load := afs.FromGGPKCached
+	if nocache {
+		load = afs.FromGGPK
+	}
+	root, err := load(archive)
 	done(err)
+	if root, err = afs.OverlayDirs(root, afs.Follow, overlays...); err != nil {
+		log.Fatalf("Cannot apply overlay: %s", err)
+	}
+
+	v := origNode.Version
+	if version != 0 {
+		v = record.Version(version)
+	}
 
 	fmt.Print("Creating result.ggpk")
 	dest, err := os.Create("result.ggpk")
@@ -37,17 +80,15 @@ func main() {
 
 	fmt.Print("Writing signature ... ")
 	// write sign
-	ggg := record.GGGRecord{}
-	ggg.Offsets = make([]uint64, 1)
-	ggg.NodeCount = 1
-	ggg.Header.Length = uint32(ggg.ByteLength())
-	ggg.Header.Tag = "GGPK"
+	ggg := record.NewGGG(v)
 	ggg.Offsets[0] = uint64(ggg.ByteLength())
 	done(ggg.Save(dest))
 
-	dirs, files := generate.FromAFS(root, uint64(ggg.Header.Length))
-	_ = dirs
-	_ = files
+	opt := generate.Options{Version: v}
+	if drop {
+		opt.Attachments = generate.Drop
+	}
+	dirs, files, raws := generate.FromAFS(root, uint64(ggg.Header.Length), opt)
 
 	size := ggg.Header.Length
 	for _, d := range dirs {
@@ -89,4 +130,18 @@ func main() {
 		p(cur, totalFileBytes)
 	}
 	done(nil)
+
+	if len(raws) > 0 {
+		fmt.Printf("Writing %d preserved records ... ", len(raws))
+		for _, r := range raws {
+			r.Save(dest)
+		}
+		done(nil)
+	}
 }
+
+// multi is a string flag which can be repeated
+type multi []string
+
+func (l *multi) String() string     { return strings.Join(*l, ",") }
+func (l *multi) Set(v string) error { *l = append(*l, v); return nil }
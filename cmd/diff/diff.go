@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Patrolavia/ggpk/afs"
+)
+
+var (
+	asJSON  bool
+	nocache bool
+)
+
+func init() {
+	flag.BoolVar(&asJSON, "json", false, "Print changes as JSON, one per line.")
+	flag.BoolVar(&nocache, "nocache", false, "Parse whole ggpk file instead of using cached index.")
+}
+
+func load(fn string) *afs.Directory {
+	f, err := os.Open(fn)
+	if err != nil {
+		log.Fatalf("Cannot open ggpk file at %s: %s", fn, err)
+	}
+
+	load := afs.FromGGPKCached
+	if nocache {
+		load = afs.FromGGPK
+	}
+	root, err := load(f)
+	if err != nil {
+		log.Fatalf("Cannot parse %s: %s", fn, err)
+	}
+	return root
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() < 2 {
+		log.Fatal("You have to specify old and new ggpk file.")
+	}
+
+	changes, err := afs.Diff(load(flag.Arg(0)), load(flag.Arg(1)))
+	if err != nil {
+		log.Fatalf("Cannot compare: %s", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, c := range changes {
+		if asJSON {
+			if err := enc.Encode(c); err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
+
+		switch c.Type {
+		case afs.Added:
+			fmt.Println("A", c.Path)
+		case afs.Removed:
+			fmt.Println("D", c.Path)
+		case afs.Modified:
+			fmt.Println("M", c.Path)
+		case afs.Renamed:
+			fmt.Println("R", c.OldPath, "->", c.Path)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/Patrolavia/ggpk/afs"
+)
+
+var (
+	nocache bool
+	quiet   bool
+)
+
+func init() {
+	flag.BoolVar(&nocache, "nocache", false, "Parse whole ggpk file instead of using cached index.")
+	flag.BoolVar(&quiet, "q", false, "Print only summary of duplicated files.")
+}
+
+func main() {
+	flag.Parse()
+	fn := flag.Arg(0)
+	f, err := os.Open(fn)
+	if err != nil {
+		log.Fatalf("Cannot open ggpk file at %s: %s", fn, err)
+	}
+	defer f.Close()
+
+	load := afs.FromGGPKCached
+	if nocache {
+		load = afs.FromGGPK
+	}
+	root, err := load(f)
+	if err != nil {
+		log.Fatalf("Parse error: %s", err)
+	}
+
+	idx, err := afs.NewDigestIndex(root)
+	if err != nil {
+		log.Fatalf("Cannot index %s: %s", fn, err)
+	}
+
+	if flag.NArg() > 1 {
+		for _, local := range flag.Args()[1:] {
+			find(idx, local)
+		}
+		return
+	}
+
+	groups := idx.Duplicates()
+	files, wasted := 0, uint64(0)
+	for _, g := range groups {
+		files += len(g.Files)
+		wasted += g.Wasted()
+		if quiet {
+			continue
+		}
+		fmt.Printf("%x (%d bytes x %d)\n", g.Digest, g.Size, len(g.Files))
+		for _, f := range g.Files {
+			fmt.Println("  " + f.Path)
+		}
+	}
+	fmt.Printf("%d files in %d groups are duplicated, %d bytes wasted.\n", files, len(groups), wasted)
+}
+
+// find prints paths in ggpk file with same content as local file
+func find(idx afs.DigestIndex, local string) {
+	f, err := os.Open(local)
+	if err != nil {
+		log.Fatalf("Cannot open %s: %s", local, err)
+	}
+	defer f.Close()
+
+	found, err := idx.FindContent(f)
+	if err != nil {
+		log.Fatalf("Cannot read %s: %s", local, err)
+	}
+	if len(found) == 0 {
+		fmt.Printf("%s: not found\n", local)
+		return
+	}
+	for _, af := range found {
+		fmt.Printf("%s: %s\n", local, af.Path)
+	}
+}
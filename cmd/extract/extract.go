@@ -3,6 +3,8 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
@@ -14,11 +16,23 @@ import (
 var (
 	recursive bool
 	destDir   string
+	fold      bool
+	verify    bool
+	nocache   bool
+	overlays  multi
+	includes  multi
+	excludes  multi
 )
 
 func init() {
 	flag.BoolVar(&recursive, "r", false, "Recursive extract directory, ignored if extracting file.")
 	flag.StringVar(&destDir, "d", ".", "Extract files to directory `N`.")
+	flag.BoolVar(&fold, "i", false, "Resolve path like game client: case insensitive, backslash is also separator.")
+	flag.BoolVar(&verify, "verify", false, "Verify digest of extracted files, stop on corrupted file.")
+	flag.BoolVar(&nocache, "nocache", false, "Parse whole ggpk file instead of using cached index.")
+	flag.Var(&overlays, "overlay", "Layer directory `D` over ggpk file, can be repeated. Files or directories named .wh.NAME delete NAME.")
+	flag.Var(&includes, "include", "Only files matching glob `P` are processed, can be repeated. Supports **, [a-z], {a,b} and ! for negation.")
+	flag.Var(&excludes, "exclude", "Skip files matching glob `P`, can be repeated.")
 	flag.Parse()
 }
 
@@ -28,60 +42,60 @@ func main() {
 	if path == "" {
 		log.Fatalf("You have to specify path to extract.")
 	}
-	if path[len(path)-1] == "/"[0] {
-		path = path[:len(path)-1]
-	}
 	f, err := os.Open(fn)
 	if err != nil {
 		log.Fatalf("Cannot open ggpk file at %s: %s", fn, err)
 	}
 	defer f.Close()
 
+	var archive io.ReaderAt = f
+	if verify {
+		archive = afs.Verify(f)
+	}
+
 	log.Print("Parsing ggpk file ...")
-	root, err := afs.FromGGPK(f)
+	load := afs.FromGGPKCached
+	if nocache {
+		load = afs.FromGGPK
+	}
+	root, err := load(archive)
 	if err != nil {
 		log.Fatalf("Parse error: %s", err)
 	}
-
-	if path == "" {
-		saveDir(root, f)
-		return
+	if root, err = afs.OverlayDirs(root, afs.Follow, overlays...); err != nil {
+		log.Fatalf("Cannot apply overlay: %s", err)
 	}
 
-	cur := root
-	nodes := strings.Split(path[1:], "/")
-Orz:
-	for idx, node := range nodes {
-		if idx == len(nodes)-1 {
-			for _, file := range cur.Files {
-				if file.Name == node {
-					saveFile(file, f)
-					return
-				}
-			}
-		}
-
-		for _, dir := range cur.Subfolders {
-			if dir.Name == node {
-				if idx == len(nodes)-1 {
-					saveDir(dir, f)
-					return
-				}
-				cur = dir
-				continue Orz
-			}
-		}
-		log.Fatalf("Cannot find %s in %s", node, cur.Path)
+	mode := afs.Exact
+	if fold {
+		mode = afs.GameClient
+	}
+	node, err := root.Resolve(path, mode)
+	if err != nil {
+		log.Fatalf("Cannot extract %s: %s", path, err)
+	}
 
+	switch n := node.(type) {
+	case *afs.File:
+		saveFile(n, f)
+	case *afs.Directory:
+		saveDir(n, f)
 	}
 }
 
-func saveFile(file *afs.File, f *os.File) {
+// multi is a string flag which can be repeated
+type multi []string
+
+func (l *multi) String() string     { return strings.Join(*l, ",") }
+func (l *multi) Set(v string) error { *l = append(*l, v); return nil }
+
+func saveFile(file *afs.File, f io.ReaderAt) {
 	fmt.Printf("Writing file %s ... ", file.Path)
-	data, err := file.Content()
+	r, err := file.Open()
 	if err != nil {
 		log.Fatalf("While reading file %s: %s", file.Path, err)
 	}
+	defer r.Close()
 
 	fn := filepath.FromSlash(destDir + file.Path)
 	dirname := filepath.Dir(fn)
@@ -95,20 +109,28 @@ func saveFile(file *afs.File, f *os.File) {
 	}
 	defer dest.Close()
 
-	if _, err := dest.Write(data); err != nil {
+	if _, err := io.Copy(dest, r); err != nil {
 		log.Fatalf("Error writing file %s: %s", file.Path, err)
 	}
 	fmt.Printf("%d bytes\n", file.Size)
 }
 
-func saveDir(dir *afs.Directory, f *os.File) {
-	for _, file := range dir.Files {
-		saveFile(file, f)
+func saveDir(dir *afs.Directory, f io.ReaderAt) {
+	m, err := afs.NewFilter(includes, excludes)
+	if err != nil {
+		log.Fatalf("Invalid pattern: %s", err)
 	}
-
-	if recursive {
-		for _, child := range dir.Subfolders {
-			saveDir(child, f)
+	dir.Walk(func(n afs.Node) error {
+		switch x := n.(type) {
+		case *afs.Directory:
+			if x != dir && (!recursive || !m.MayContain(x.Path)) {
+				return fs.SkipDir
+			}
+		case *afs.File:
+			if m.Match(x.Path) {
+				saveFile(x, f)
+			}
 		}
-	}
+		return nil
+	})
 }
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/Patrolavia/ggpk/record"
+)
+
+var (
+	step  int
+	limit uint64
+)
+
+func init() {
+	flag.IntVar(&step, "step", 0, "Step `N` records forward from target before inspecting, backward if negative.")
+	flag.Uint64Var(&limit, "n", 64, "Dump at most `N` bytes of file content.")
+}
+
+func main() {
+	flag.Parse()
+	fn := flag.Arg(0)
+	target := flag.Arg(1)
+	if target == "" {
+		log.Fatal("You have to specify an offset or a path to inspect.")
+	}
+
+	f, err := os.Open(fn)
+	if err != nil {
+		log.Fatalf("Cannot open ggpk file at %s: %s", fn, err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		log.Fatalf("Cannot stat ggpk file at %s: %s", fn, err)
+	}
+	r := io.NewSectionReader(f, 0, info.Size())
+
+	g, err := record.GGG(r)
+	if err != nil {
+		log.Fatalf("Cannot read ggpk signature: %s", err)
+	}
+
+	off := resolve(r, g, target)
+	if step != 0 {
+		off = walk(r, off, step)
+	}
+	inspect(r, g, off)
+}
+
+// resolve converts target, which is an offset or a path, to offset of the record
+func resolve(r *io.SectionReader, g record.GGGRecord, target string) uint64 {
+	if !strings.HasPrefix(target, "/") {
+		off, err := strconv.ParseUint(target, 0, 64)
+		if err != nil {
+			log.Fatalf("Invalid offset %s: %s", target, err)
+		}
+		return off
+	}
+
+	nodes, err := g.Children(r)
+	if err != nil {
+		log.Fatalf("Cannot read root nodes: %s", err)
+	}
+	var cur record.DirectoryRecord
+	off := uint64(0)
+	for _, n := range nodes {
+		if n.Tag == "PDIR" {
+			off = n.Start()
+			if cur, err = record.ReadDir(r, n, g.Version); err != nil {
+				log.Fatalf("Cannot read root directory: %s", err)
+			}
+			break
+		}
+	}
+	if off == 0 {
+		log.Fatal("Cannot find root directory.")
+	}
+
+	path := strings.Trim(target, "/")
+	if path == "" {
+		return off
+	}
+	names := strings.Split(path, "/")
+	for idx, name := range names {
+		h, rec, err := cur.Find(r, name)
+		if err != nil {
+			log.Fatalf("Cannot find %s in /%s: %s", name, strings.Join(names[:idx], "/"), err)
+		}
+		off = h.Start()
+		if idx == len(names)-1 {
+			break
+		}
+
+		dir, ok := rec.(record.DirectoryRecord)
+		if !ok {
+			log.Fatalf("/%s is not a directory", strings.Join(names[:idx+1], "/"))
+		}
+		cur = dir
+	}
+	return off
+}
+
+// walk steps n records forward or backward from record at offset off
+func walk(r *io.SectionReader, off uint64, n int) uint64 {
+	s := record.NewScanner(r, r.Size())
+	if n > 0 {
+		s.Seek(off)
+		for i := 0; i <= n; i++ {
+			if !s.Scan() {
+				if err := s.Err(); err != nil {
+					log.Fatalf("Cannot step forward: %s", err)
+				}
+				log.Fatalf("Cannot step %d records forward: reached end of file", n)
+			}
+		}
+		return s.Header().Start()
+	}
+
+	// scan from beginning, keeping offsets of last -n records before target
+	if off == 0 {
+		log.Fatalf("Cannot step %d records backward: reached beginning of file", -n)
+	}
+	prev := []uint64{0}
+	found := false
+	for s.Scan() {
+		start := s.Header().Start()
+		if start == off {
+			found = true
+			break
+		}
+		if start > off {
+			log.Fatalf("Offset %d is not start of a record", off)
+		}
+		prev = append(prev, start)
+		if len(prev) > -n {
+			prev = prev[1:]
+		}
+	}
+	if err := s.Err(); err != nil {
+		log.Fatalf("Cannot step backward: %s", err)
+	}
+	if !found {
+		log.Fatalf("Offset %d is not start of a record: reached end of file", off)
+	}
+	if len(prev) < -n {
+		log.Fatalf("Cannot step %d records backward: reached beginning of file", -n)
+	}
+	return prev[0]
+}
+
+// field is a range of bytes in ggpk file
+type field struct {
+	name string
+	off  uint64
+	size uint64
+}
+
+func inspect(r *io.SectionReader, g record.GGGRecord, off uint64) {
+	if off == 0 {
+		h := g.Header
+		fmt.Printf("Offset:   %d (0x%x)\nLength:   %d\nTag:      %s\n", h.Start(), h.Start(), h.Length, h.Tag)
+		fmt.Printf("Version:  %d\nOffsets:  %d, %d\n\n", g.Version, g.Offsets[0], g.Offsets[1])
+		dump(r, []field{
+			{"length", 0, 4},
+			{"tag", 4, 4},
+			{"version", 8, 4},
+			{"offsets", 12, uint64(h.Length) - 12},
+		})
+		return
+	}
+
+	h, rec, err := record.Decode(r, off, g.Version)
+	var corrupt *record.CorruptError
+	if errors.As(err, &corrupt) {
+		broken(r, off, err)
+	}
+	if err != nil {
+		log.Fatalf("Cannot decode record at %d: %s", off, err)
+	}
+
+	fmt.Printf("Offset:   %d (0x%x)\nLength:   %d\nTag:      %s\n", h.Start(), h.Start(), h.Length, h.Tag)
+	fields := []field{{"length", h.Start(), 4}, {"tag", h.Start() + 4, 4}}
+	data := h.Offset
+	switch x := rec.(type) {
+	case record.FileRecord:
+		name := uint64(x.ByteLength()) - 4 - 32
+		size := uint64(h.Length) - uint64(h.ByteLength()+x.ByteLength())
+		content := data + uint64(x.ByteLength())
+		fmt.Printf("Name:     %s (%d characters)\nSize:     %d\nDigest:   %x\n", x.Name, x.NameLength, size, x.Digest)
+		sum := fileDigest(r, content, size)
+		fmt.Printf("Computed: %x %s\n\n", sum, match(x.Digest, sum))
+
+		if size > limit {
+			size = limit
+		}
+		fields = append(fields,
+			field{"name length", data, 4},
+			field{"digest", data + 4, 32},
+			field{"name", data + 36, name},
+			field{"content", content, size},
+		)
+	case record.DirectoryRecord:
+		name := uint64(x.NameLength) * uint64(g.Version.CharSize())
+		fmt.Printf("Name:     %s (%d characters)\nChildren: %d\nDigest:   %x\n", x.Name, x.NameLength, x.ChildCount, x.Digest)
+		sum := entries(r, x)
+		fmt.Printf("Computed: %x %s\n\n", sum, match(x.Digest, sum))
+
+		fields = append(fields,
+			field{"name length", data, 4},
+			field{"child count", data + 4, 4},
+			field{"digest", data + 8, 32},
+			field{"name", data + 40, name},
+		)
+		for idx := range x.Entries {
+			pos := data + 40 + name + uint64(idx)*12
+			fields = append(fields,
+				field{fmt.Sprintf("entry %d hash", idx), pos, 4},
+				field{fmt.Sprintf("entry %d offset", idx), pos + 4, 8},
+			)
+		}
+	case record.FreeRecord:
+		fmt.Printf("Next:     %d\n\n", x.Next)
+		fields = append(fields, field{"next", data, 8})
+	case record.RawRecord:
+		fmt.Printf("Data:     %d bytes\n\n", len(x.Data))
+		size := uint64(len(x.Data))
+		if size > limit {
+			size = limit
+		}
+		fields = append(fields, field{"data", data, size})
+	}
+	dump(r, fields)
+}
+
+// broken prints header and raw bytes of corrupted record at offset off, and then reports err
+func broken(r *io.SectionReader, off uint64, err error) {
+	avail := uint64(0)
+	if size := uint64(r.Size()); off < size {
+		avail = size - off
+	}
+
+	// header is decoded even if its length is wrong
+	h, _ := record.Header(r, off)
+	if avail < uint64(h.ByteLength()) {
+		fmt.Printf("Offset:   %d (0x%x)\n\n", off, off)
+		dump(r, []field{{"raw", off, avail}})
+		log.Fatalf("Cannot decode record at %d: %s", off, err)
+	}
+
+	fmt.Printf("Offset:   %d (0x%x)\nLength:   %d\nTag:      %s\n\n", h.Start(), h.Start(), h.Length, h.Tag)
+	size := avail - uint64(h.ByteLength())
+	if l := uint64(h.Length); l >= uint64(h.ByteLength()) && l-uint64(h.ByteLength()) < size {
+		size = l - uint64(h.ByteLength())
+	}
+	if size > limit {
+		size = limit
+	}
+	dump(r, []field{{"length", h.Start(), 4}, {"tag", h.Start() + 4, 4}, {"data", h.Offset, size}})
+	log.Fatalf("Cannot decode record at %d: %s", off, err)
+}
+
+func match(stored, computed []byte) string {
+	if bytes.Equal(stored, computed) {
+		return "(ok)"
+	}
+	return "(MISMATCH)"
+}
+
+func fileDigest(r io.ReaderAt, off, size uint64) []byte {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(r, int64(off), int64(size))); err != nil {
+		log.Fatalf("Cannot read file content: %s", err)
+	}
+	return h.Sum(nil)
+}
+
+// entries prints entry table of directory d, and returns digest computed from child digests
+func entries(r io.ReaderAt, d record.DirectoryRecord) []byte {
+	fmt.Printf("%5s  %-8s  %-8s  %12s  %-4s  %s\n", "#", "hash", "expected", "offset", "tag", "name")
+	h := sha256.New()
+	for idx, e := range d.Entries {
+		ch, rec, err := record.Decode(r, e.Offset, d.Version)
+		if err != nil {
+			fmt.Printf("%5d  %08x  %-8s  %12d  %-4s  %s\n", idx, e.Hash, "", e.Offset, "", err)
+			continue
+		}
+
+		name, expected := "", ""
+		switch x := rec.(type) {
+		case record.FileRecord:
+			name = x.Name
+			h.Write(x.Digest)
+		case record.DirectoryRecord:
+			name = x.Name + "/"
+			h.Write(x.Digest)
+		}
+		if name != "" {
+			if hash := d.Version.Hash(strings.TrimSuffix(name, "/")); hash != e.Hash {
+				expected = fmt.Sprintf("%08x", hash)
+			} else {
+				expected = "ok"
+			}
+		}
+		fmt.Printf("%5d  %08x  %-8s  %12d  %-4s  %s\n", idx, e.Hash, expected, e.Offset, ch.Tag, name)
+	}
+	fmt.Println()
+	return h.Sum(nil)
+}
+
+// dump prints hex dump of fields, labeling first line of each field
+func dump(r io.ReaderAt, fields []field) {
+	for _, f := range fields {
+		data := make([]byte, f.size)
+		if n, err := r.ReadAt(data, int64(f.off)); n < len(data) {
+			log.Fatalf("Cannot read %s at %d: %s", f.name, f.off, err)
+		}
+
+		for pos := 0; pos < len(data) || pos == 0; pos += 16 {
+			end := pos + 16
+			if end > len(data) {
+				end = len(data)
+			}
+			chunk := data[pos:end]
+
+			hex := make([]string, len(chunk))
+			ascii := make([]byte, len(chunk))
+			for k, b := range chunk {
+				hex[k] = fmt.Sprintf("%02x", b)
+				ascii[k] = '.'
+				if b >= 0x20 && b < 0x7f {
+					ascii[k] = b
+				}
+			}
+
+			line := fmt.Sprintf("%08x  %-47s  |%-16s|", f.off+uint64(pos), strings.Join(hex, " "), ascii)
+			if pos == 0 {
+				line += "  " + f.name
+			}
+			fmt.Println(line)
+		}
+	}
+}
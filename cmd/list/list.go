@@ -3,12 +3,28 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/Patrolavia/ggpk/afs"
 )
 
+var (
+	nocache  bool
+	overlays multi
+	includes multi
+	excludes multi
+)
+
+func init() {
+	flag.BoolVar(&nocache, "nocache", false, "Parse whole ggpk file instead of using cached index.")
+	flag.Var(&overlays, "overlay", "Layer directory `D` over ggpk file, can be repeated. Files or directories named .wh.NAME delete NAME.")
+	flag.Var(&includes, "include", "Only files matching glob `P` are processed, can be repeated. Supports **, [a-z], {a,b} and ! for negation.")
+	flag.Var(&excludes, "exclude", "Skip files matching glob `P`, can be repeated.")
+}
+
 func main() {
 	flag.Parse()
 	fn := flag.Arg(0)
@@ -18,21 +34,44 @@ func main() {
 	}
 	defer f.Close()
 
-	root, err := afs.FromGGPK(f)
+	load := afs.FromGGPKCached
+	if nocache {
+		load = afs.FromGGPK
+	}
+	root, err := load(f)
 	if err != nil {
 		log.Fatalf("Parse error: %s", err)
 	}
-
-	traverse(root)
-}
-
-func traverse(dir *afs.Directory) {
-	fmt.Println(dir.Path)
-	for _, e := range dir.Files {
-		fmt.Println(e.Path)
+	if root, err = afs.OverlayDirs(root, afs.Follow, overlays...); err != nil {
+		log.Fatalf("Cannot apply overlay: %s", err)
 	}
 
-	for _, e := range dir.Subfolders {
-		traverse(e)
+	// directories are not listed when filtering files
+	m, err := afs.NewFilter(includes, excludes)
+	if err != nil {
+		log.Fatalf("Invalid pattern: %s", err)
 	}
+	filter := len(includes)+len(excludes) > 0
+	root.Walk(func(n afs.Node) error {
+		switch x := n.(type) {
+		case *afs.Directory:
+			if !m.MayContain(x.Path) {
+				return fs.SkipDir
+			}
+			if !filter {
+				fmt.Println(x.Path)
+			}
+		case *afs.File:
+			if m.Match(x.Path) {
+				fmt.Println(x.Path)
+			}
+		}
+		return nil
+	})
 }
+
+// multi is a string flag which can be repeated
+type multi []string
+
+func (l *multi) String() string     { return strings.Join(*l, ",") }
+func (l *multi) Set(v string) error { *l = append(*l, v); return nil }
@@ -1,37 +1,65 @@
 package generate
 
 import (
+	"crypto/sha256"
 	"log"
 
 	"github.com/Patrolavia/ggpk/afs"
 	"github.com/Patrolavia/ggpk/record"
 )
 
-func generate(root *afs.Directory, parent *record.DirectoryEntry) (dirs []GGPKDirectory, files []GGPKFile) {
-	dirs = append(dirs, NewGGPKDirectory(root, parent))
-	idx := 0
-	me := &dirs[len(dirs)-1]
-	for _, f := range root.Files {
-		files = append(files, NewGGPKFile(f, &me.Record.Entries[idx]))
-		idx++
-	}
+// Policy decides what to do with attachments of afs directories
+type Policy int
+
+const (
+	Preserve Policy = iota // write attachments back to ggpk file
+	Drop                   // leave attachments out
+)
 
-	for _, dir := range root.Subfolders {
-		d, f := generate(dir, &me.Record.Entries[idx])
-		idx++
-		dirs = append(dirs, d...)
-		files = append(files, f...)
+// Options controls how ggpk records are generated
+type Options struct {
+	Version     record.Version // names are encoded as this ggpk version
+	Attachments Policy
+}
+
+func generate(root *afs.Directory, parent *record.DirectoryEntry, opt Options) (dirs []GGPKDirectory, files []GGPKFile, raws []GGPKRaw) {
+	dirs = append(dirs, NewGGPKDirectory(root, parent, opt))
+	entries := dirs[0].Record.Entries
+	list := root.Entries(opt.Version, opt.Attachments == Preserve)
+	if len(list) != len(entries) {
+		log.Fatalf("%d, %d", len(list), len(entries))
 	}
-	if idx != len(me.Record.Entries) {
-		log.Fatalf("%d, %d", idx, len(me.Record.Entries))
+
+	// digest of directory is computed in the order of entries, like afs.Directory.Digest
+	digest := sha256.New()
+	for idx, c := range list {
+		switch x := c.Node.(type) {
+		case *afs.File:
+			files = append(files, NewGGPKFile(x, &entries[idx], opt.Version))
+			digest.Write(x.Digest)
+		case *afs.Directory:
+			d, f, r := generate(x, &entries[idx], opt)
+			digest.Write(d[0].Record.Digest)
+			dirs = append(dirs, d...)
+			files = append(files, f...)
+			raws = append(raws, r...)
+		default:
+			raws = append(raws, NewGGPKRaw(c.Attachment, &entries[idx]))
+		}
 	}
+	dirs[0].Record.Digest = digest.Sum(nil)
 
 	return
 }
 
-// FromAFS create series of GGPKDirectory and GGPKFile, which can be saved to file later.
-func FromAFS(root *afs.Directory, offset uint64) (dirs []GGPKDirectory, files []GGPKFile) {
-	dirs, files = generate(root, nil)
+// FromAFS create series of GGPKDirectory, GGPKFile and GGPKRaw, which can be saved to file later.
+//
+// Entries of directories are ordered by afs.Directory.Entries, and directory
+// digests are computed in that order, as the game does. So directories of a
+// ggpk file from the game keep their entry order and digest, and digest of
+// root record equals Digest of root.
+func FromAFS(root *afs.Directory, offset uint64, opt Options) (dirs []GGPKDirectory, files []GGPKFile, raws []GGPKRaw) {
+	dirs, files, raws = generate(root, nil, opt)
 	curOffset := uint64(dirs[0].Header.Length) + offset
 	for idx := 1; idx < len(dirs); idx++ {
 		dirs[idx].Parent.Offset = curOffset
@@ -41,5 +69,9 @@ func FromAFS(root *afs.Directory, offset uint64) (dirs []GGPKDirectory, files []
 		files[idx].Parent.Offset = curOffset
 		curOffset += uint64(files[idx].Header.Length)
 	}
+	for idx := 0; idx < len(raws); idx++ {
+		raws[idx].Parent.Offset = curOffset
+		curOffset += uint64(raws[idx].Record.Header.Length)
+	}
 	return
 }
@@ -2,18 +2,13 @@
 package generate
 
 import (
-	"encoding/binary"
+	"io"
 	"log"
-	"os"
 
 	"github.com/Patrolavia/ggpk/afs"
 	"github.com/Patrolavia/ggpk/record"
 )
 
-func w(f *os.File, data interface{}) error {
-	return binary.Write(f, binary.LittleEndian, data)
-}
-
 // GGPKFile is ggpk record represents an afs file
 type GGPKFile struct {
 	Header record.RecordHeader
@@ -23,12 +18,8 @@ type GGPKFile struct {
 }
 
 // NewGGPKFile creates GGPKFile from afs file
-func NewGGPKFile(file *afs.File, parent *record.DirectoryEntry) (ret GGPKFile) {
-	ret.Record = record.FileRecord{
-		NameLength: uint32(len(file.Name) + 1),
-		Digest:     file.Digest,
-		Name:       file.Name,
-	}
+func NewGGPKFile(file *afs.File, parent *record.DirectoryEntry, v record.Version) (ret GGPKFile) {
+	ret.Record = record.NewFile(file.Name, file.Digest, v)
 	ret.Header = record.RecordHeader{
 		Length: uint32(ret.Record.ByteLength()) + uint32(file.Size),
 		Tag:    "FILE",
@@ -36,13 +27,13 @@ func NewGGPKFile(file *afs.File, parent *record.DirectoryEntry) (ret GGPKFile) {
 	ret.Header.Length += uint32(ret.Header.ByteLength())
 	ret.Parent = parent
 	ret.Orig = file
-	parent.Timestamp = file.Timestamp
+	parent.Hash = v.Hash(file.Name)
 	return
 
 }
 
-// Save record to ggpk file, without checking timestamp, digest or file offset
-func (file GGPKFile) Save(f *os.File) {
+// Save record to ggpk file, without checking name hash, digest or file offset
+func (file GGPKFile) Save(f io.Writer) {
 	path := file.Orig.Path
 	if err := file.Header.Save(f); err != nil {
 		log.Fatalf("While writing header of %s: %s", path, err)
@@ -52,14 +43,19 @@ func (file GGPKFile) Save(f *os.File) {
 		log.Fatalf("While writing info of %s: %s", path, err)
 	}
 
-	data, err := file.Orig.Content()
+	r, err := file.Orig.Open()
 	if err != nil {
 		log.Fatalf("While reading content of %s: %s", path, err)
 	}
+	defer r.Close()
 
-	if err := w(f, data); err != nil {
+	n, err := io.Copy(f, r)
+	if err != nil {
 		log.Fatalf("While writing content of %s: %s", path, err)
 	}
+	if n != int64(file.Size()) {
+		log.Fatalf("While writing content of %s: %d bytes written, %d expected", path, n, file.Size())
+	}
 }
 
 // Size reports file size
@@ -75,14 +71,18 @@ type GGPKDirectory struct {
 }
 
 // NewGGPKDirectory creates ggpk record from afs directory
-func NewGGPKDirectory(dir *afs.Directory, parent *record.DirectoryEntry) (ret GGPKDirectory) {
-	ret.Record = record.DirectoryRecord{
-		NameLength: uint32(len(dir.Name) + 1),
-		ChildCount: uint32(len(dir.Subfolders) + len(dir.Files)),
-		Digest:     dir.Digest(),
-		Name:       dir.Name,
-		Entries:    make([]record.DirectoryEntry, len(dir.Subfolders)+len(dir.Files)),
+func NewGGPKDirectory(dir *afs.Directory, parent *record.DirectoryEntry, opt Options) (ret GGPKDirectory) {
+	v := opt.Version
+	count := len(dir.Subfolders) + len(dir.Files)
+	if opt.Attachments == Preserve {
+		count += len(dir.Attachments)
 	}
+	ret.Record = record.NewDirectory(
+		dir.Name,
+		dir.Digest(),
+		make([]record.DirectoryEntry, count),
+		v,
+	)
 	ret.Header = record.RecordHeader{
 		Length: 0,
 		Tag:    "PDIR",
@@ -90,14 +90,14 @@ func NewGGPKDirectory(dir *afs.Directory, parent *record.DirectoryEntry) (ret GG
 	ret.Header.Length = uint32(ret.Header.ByteLength() + ret.Record.ByteLength())
 	ret.Parent = parent
 	if parent != nil {
-		parent.Timestamp = dir.Timestamp
+		parent.Hash = v.Hash(dir.Name)
 	}
 
 	return
 }
 
-// Save record to ggpk file, without checking timestamp, digest or file offset
-func (dir GGPKDirectory) Save(f *os.File) {
+// Save record to ggpk file, without checking name hash, digest or file offset
+func (dir GGPKDirectory) Save(f io.Writer) {
 	if err := dir.Header.Save(f); err != nil {
 		log.Fatalf("Failed to save directory header of %s: %s", dir.Record.Name, err)
 	}
@@ -105,3 +105,29 @@ func (dir GGPKDirectory) Save(f *os.File) {
 		log.Fatalf("Failed to save directory record of %s: %s", dir.Record.Name, err)
 	}
 }
+
+// GGPKRaw is ggpk record represents an afs attachment
+type GGPKRaw struct {
+	Record record.RawRecord
+	Parent *record.DirectoryEntry
+}
+
+// NewGGPKRaw creates ggpk record from afs attachment
+//
+// Link to next free record is cleared for free records, as it is meaningless in new file.
+func NewGGPKRaw(a *afs.Attachment, parent *record.DirectoryEntry) (ret GGPKRaw) {
+	ret.Record = a.Record
+	if ret.Record.Header.Tag == "FREE" && len(ret.Record.Data) >= 8 {
+		ret.Record.Data = append([]byte{0, 0, 0, 0, 0, 0, 0, 0}, ret.Record.Data[8:]...)
+	}
+	ret.Parent = parent
+	parent.Hash = a.Hash
+	return
+}
+
+// Save record to ggpk file, without checking file offset
+func (raw GGPKRaw) Save(f io.Writer) {
+	if err := raw.Record.Save(f); err != nil {
+		log.Fatalf("Failed to save %s record: %s", raw.Record.Header.Tag, err)
+	}
+}
@@ -0,0 +1,260 @@
+package record
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+)
+
+// window is how many bytes are read at once when decoding a record, large
+// enough to hold most PDIR records and metadata part of FILE records
+const window = 4096
+
+// step is the most bytes allocated for a read before knowing they exist, so a
+// lying header cannot make us allocate gigabytes if size of file is unknown
+const step = 1 << 20
+
+var buffers = sync.Pool{New: func() interface{} {
+	b := make([]byte, window)
+	return &b
+}}
+
+// chunk is data of a record, read into pooled buffer by a single ReadAt
+type chunk struct {
+	r    io.ReaderAt
+	h    RecordHeader
+	buf  *[]byte
+	data []byte // data of record h, might be only a prefix of it
+}
+
+// fetch reads at most n bytes from r at offset off, short read at end of file is not an error
+func fetch(r io.ReaderAt, off uint64, n uint64) (buf *[]byte, data []byte, err error) {
+	if off > math.MaxInt64 {
+		// no file is that large, it is a bogus offset read from corrupted record
+		return
+	}
+	if n > step {
+		return fetchLarge(r, off, n)
+	}
+	if n <= window {
+		buf = buffers.Get().(*[]byte)
+	} else {
+		b := make([]byte, n)
+		buf = &b
+	}
+
+	data = (*buf)[:n]
+	m, err := r.ReadAt(data, int64(off))
+	if m == len(data) || err == io.EOF {
+		return buf, data[:m], nil
+	}
+	if cap(*buf) == window {
+		buffers.Put(buf)
+	}
+	return nil, nil, err
+}
+
+// fetchLarge is fetch, but buffer is grown as data is read
+func fetchLarge(r io.ReaderAt, off uint64, n uint64) (buf *[]byte, data []byte, err error) {
+	for size := uint64(step); ; size *= 2 {
+		if size > n {
+			size = n
+		}
+		if uint64(cap(data)) < size {
+			grown := make([]byte, len(data), size)
+			copy(grown, data)
+			data = grown
+		}
+
+		m, e := r.ReadAt(data[len(data):size], int64(off)+int64(len(data)))
+		data = data[:len(data)+m]
+		if uint64(len(data)) == n || (e == io.EOF && uint64(len(data)) < size) {
+			return &data, data, nil
+		}
+		if e != nil {
+			return nil, nil, e
+		}
+	}
+}
+
+// release returns buffer to pool, c must not be used after release
+func (c *chunk) release() {
+	if c.buf != nil && cap(*c.buf) == window {
+		buffers.Put(c.buf)
+	}
+	c.buf, c.data = nil, nil
+}
+
+// dataLength returns size of data of record h
+func dataLength(h RecordHeader) uint64 {
+	return uint64(h.Length) - uint64(h.ByteLength())
+}
+
+// readChunk reads data of record described by h
+func readChunk(r io.ReaderAt, h RecordHeader) (c *chunk, err error) {
+	n := dataLength(h)
+	if n > window {
+		n = window
+	}
+	c = &chunk{r: r, h: h}
+	c.buf, c.data, err = fetch(r, h.Offset, n)
+	return
+}
+
+// openChunk reads header and data of the record starting at offset off, by single ReadAt if possible
+func openChunk(r io.ReaderAt, off uint64) (c *chunk, err error) {
+	c = &chunk{r: r}
+	if c.buf, c.data, err = fetch(r, off, window); err != nil {
+		return
+	}
+	if c.h, err = parseHeader(r, off, c.data); err != nil {
+		c.release()
+		return
+	}
+
+	c.data = c.data[c.h.ByteLength():]
+	if n := dataLength(c.h); uint64(len(c.data)) > n {
+		c.data = c.data[:n]
+	}
+	return
+}
+
+// need ensures first n bytes of data are available, reading again from file if necessary
+func (c *chunk) need(n uint64) (err error) {
+	if err = fit(c.h, n); err != nil {
+		return
+	}
+	if uint64(len(c.data)) >= n {
+		return
+	}
+
+	c.release()
+	if c.buf, c.data, err = fetch(c.r, c.h.Offset, n); err != nil {
+		return
+	}
+	if uint64(len(c.data)) < n {
+		err = corrupt(c.h, "data exceeds end of file")
+	}
+	return
+}
+
+func (c *chunk) u32(pos uint64) uint32 {
+	return binary.LittleEndian.Uint32(c.data[pos:])
+}
+
+// bytes returns a copy of n bytes of data starting at pos
+func (c *chunk) bytes(pos, n uint64) []byte {
+	ret := make([]byte, n)
+	copy(ret, c.data[pos:])
+	return ret
+}
+
+// name decodes null ended name of l characters, which starts at pos
+func (c *chunk) name(pos uint64, l uint32, v Version) (ret string, err error) {
+	if l == 0 {
+		return ret, corrupt(c.h, "name length is zero")
+	}
+	size := uint64(l) * uint64(v.CharSize())
+	if err = c.need(pos + size); err != nil {
+		return
+	}
+
+	data := c.data[pos : pos+size]
+	for _, b := range data[len(data)-v.CharSize():] {
+		if b != 0 {
+			return ret, corrupt(c.h, "name is not null ended")
+		}
+	}
+	return v.DecodeName(data), nil
+}
+
+func (c *chunk) file(v Version) (ret FileRecord, err error) {
+	if err = c.need(4 + 32); err != nil {
+		return
+	}
+	l := c.u32(0)
+	d := c.bytes(4, 32)
+
+	name, err := c.name(4+32, l, v)
+	if err != nil {
+		return
+	}
+
+	ret = FileRecord{l, d, name, v, c.r}
+	return
+}
+
+func (c *chunk) dir(v Version) (ret DirectoryRecord, err error) {
+	fixed := uint64(4 + 4 + 32)
+	if err = c.need(fixed); err != nil {
+		return
+	}
+	l := c.u32(0)
+	cnt := c.u32(4)
+	d := c.bytes(8, 32)
+
+	nameSize := uint64(l) * uint64(v.CharSize())
+	entrySize := uint64(DirectoryEntry{}.ByteLength())
+	if err = c.need(fixed + nameSize + uint64(cnt)*entrySize); err != nil {
+		return
+	}
+	name, err := c.name(fixed, l, v)
+	if err != nil {
+		return
+	}
+
+	child := make([]DirectoryEntry, cnt)
+	for idx := range child {
+		pos := fixed + nameSize + uint64(idx)*entrySize
+		child[idx].Hash = c.u32(pos)
+		child[idx].Offset = binary.LittleEndian.Uint64(c.data[pos+4:])
+	}
+
+	ret = DirectoryRecord{l, cnt, d, name, v, child}
+	return
+}
+
+func (c *chunk) free() (ret FreeRecord, err error) {
+	if err = c.need(8); err != nil {
+		return
+	}
+	ret.Header = c.h
+	ret.Next = binary.LittleEndian.Uint64(c.data)
+	return
+}
+
+func (c *chunk) raw() (ret RawRecord, err error) {
+	n := dataLength(c.h)
+	if err = c.need(n); err != nil {
+		return
+	}
+	ret.Header = c.h
+	ret.Data = c.bytes(0, n)
+	return
+}
+
+// Decode reads record starting at offset off, by single ReadAt in most cases
+//
+// rec is one of FileRecord, DirectoryRecord and FreeRecord, or RawRecord if
+// tag of the record is unknown.
+func Decode(r io.ReaderAt, off uint64, v Version) (h RecordHeader, rec interface{}, err error) {
+	c, err := openChunk(r, off)
+	if err != nil {
+		return
+	}
+	defer c.release()
+
+	h = c.h
+	switch h.Tag {
+	case "FILE":
+		rec, err = c.file(v)
+	case "PDIR":
+		rec, err = c.dir(v)
+	case "FREE":
+		rec, err = c.free()
+	default:
+		rec, err = c.raw()
+	}
+	return
+}
@@ -0,0 +1,172 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// readerAt hides Size of bytes.Reader, like a reader over network
+type readerAt struct {
+	r *bytes.Reader
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.r.ReadAt(p, off)
+}
+
+func TestLyingLength(t *testing.T) {
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data, 0xfffffff0)
+	copy(data[4:], "ABCD")
+	r := readerAt{bytes.NewReader(data)}
+	if Size(r) >= 0 {
+		t.Fatal("size of reader should be unknown")
+	}
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, _, err := Decode(r, 0, Version3)
+	runtime.ReadMemStats(&after)
+
+	var corrupt *CorruptError
+	if !errors.As(err, &corrupt) {
+		t.Errorf("expected CorruptError, got %v", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 16*step {
+		t.Errorf("%d bytes allocated for a 64 bytes file", n)
+	}
+}
+
+func TestFetchLarge(t *testing.T) {
+	data := make([]byte, 3*step+5)
+	for k := range data {
+		data[k] = byte(k)
+	}
+	r := readerAt{bytes.NewReader(data)}
+
+	_, got, err := fetch(r, 3, uint64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[3:]) {
+		t.Error("short read at end of file returns wrong data")
+	}
+
+	_, got, err = fetch(r, 1, 2*step+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[1:2*step+2]) {
+		t.Error("wrong data")
+	}
+
+	if _, got, err = fetch(readerAt{bytes.NewReader(nil)}, 0, 2*step); err != nil || len(got) != 0 {
+		t.Errorf("reading empty file: %d bytes, %v", len(got), err)
+	}
+}
+
+// benchData builds a directory record with 100 entries followed by its files,
+// returns the data and offsets of all records
+func benchData(b *testing.B, v Version) (data []byte, offsets []uint64) {
+	digest := make([]byte, 32)
+	var files [][]byte
+	entries := make([]DirectoryEntry, 100)
+	for k := range entries {
+		name := fmt.Sprintf("file%03d.dat", k)
+		files = append(files, saveRecord(b, "FILE", NewFile(name, digest, v)))
+		entries[k].Hash = v.Hash(name)
+	}
+
+	dir := saveRecord(b, "PDIR", NewDirectory("Data", digest, entries, v))
+	offsets = []uint64{0}
+	off := uint64(len(dir))
+	for k, f := range files {
+		offsets = append(offsets, off)
+		entries[k].Offset = off
+		off += uint64(len(f))
+	}
+	data = saveRecord(b, "PDIR", NewDirectory("Data", digest, entries, v))
+	for _, f := range files {
+		data = append(data, f...)
+	}
+	return
+}
+
+// decodeBinaryRead decodes like Decode, but reads every field by binary.Read,
+// as records were decoded before chunk is introduced
+func decodeBinaryRead(r io.ReaderAt, off uint64, v Version) (rec interface{}, err error) {
+	h, err := Header(r, off)
+	if err != nil {
+		return
+	}
+	s := body(r, h)
+
+	var l, c uint32
+	if err = binary.Read(s, binary.LittleEndian, &l); err != nil {
+		return
+	}
+	if h.Tag == "PDIR" {
+		if err = binary.Read(s, binary.LittleEndian, &c); err != nil {
+			return
+		}
+	}
+	d := make([]byte, 32)
+	if _, err = io.ReadFull(s, d); err != nil {
+		return
+	}
+	name := make([]byte, uint64(l)*uint64(v.CharSize()))
+	if _, err = io.ReadFull(s, name); err != nil {
+		return
+	}
+	if h.Tag == "FILE" {
+		return FileRecord{l, d, v.DecodeName(name), v, r}, nil
+	}
+
+	child := make([]DirectoryEntry, c)
+	err = binary.Read(s, binary.LittleEndian, child)
+	return DirectoryRecord{l, c, d, v.DecodeName(name), v, child}, err
+}
+
+// benchmarkDecode decodes records of benchData from real file, where every ReadAt is a system call
+func benchmarkDecode(b *testing.B, decode func(io.ReaderAt, uint64, Version) (interface{}, error)) {
+	data, offsets := benchData(b, Version3)
+	fn := filepath.Join(b.TempDir(), "bench.ggpk")
+	if err := os.WriteFile(fn, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+	r, err := os.Open(fn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, off := range offsets {
+			if _, err := decode(r, off, Version3); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchmarkDecode(b, func(r io.ReaderAt, off uint64, v Version) (interface{}, error) {
+		_, rec, err := Decode(r, off, v)
+		return rec, err
+	})
+}
+
+func BenchmarkDecodeBinaryRead(b *testing.B) {
+	benchmarkDecode(b, decodeBinaryRead)
+}
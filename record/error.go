@@ -0,0 +1,49 @@
+package record
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// CorruptError reports a malformed record found in ggpk file
+type CorruptError struct {
+	Offset uint64 // file offset of the record, header included
+	Tag    string // tag of the record, empty if header is unreadable
+	Reason string
+}
+
+func (e *CorruptError) Error() string {
+	if e.Tag == "" {
+		return fmt.Sprintf("corrupted record at offset %d: %s", e.Offset, e.Reason)
+	}
+	return fmt.Sprintf("corrupted %s record at offset %d: %s", e.Tag, e.Offset, e.Reason)
+}
+
+func corrupt(h RecordHeader, format string, args ...interface{}) error {
+	return &CorruptError{h.Start(), h.Tag, fmt.Sprintf(format, args...)}
+}
+
+// truncated converts unexpected EOF while decoding record h to CorruptError
+func truncated(h RecordHeader, err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return corrupt(h, "data exceeds end of record")
+	}
+	return err
+}
+
+// Size returns size of r, or -1 if it cannot be determined
+//
+// Size of *os.File is queried every time, wrap it with io.SectionReader if you
+// are going to decode many records.
+func Size(r io.ReaderAt) int64 {
+	switch v := r.(type) {
+	case interface{ Size() int64 }:
+		return v.Size()
+	case interface{ Stat() (os.FileInfo, error) }:
+		if info, err := v.Stat(); err == nil {
+			return info.Size()
+		}
+	}
+	return -1
+}
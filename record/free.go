@@ -0,0 +1,126 @@
+package record
+
+import (
+	"io"
+	"sort"
+)
+
+// FreeRecord is free space
+//
+// Whole record, header included, can be reused when writing new records.
+type FreeRecord struct {
+	Header RecordHeader
+	Next   uint64 // file offset of next free record, 0 if this is the last one
+}
+
+// Free reads FreeRecord which starts at offset off
+func Free(r io.ReaderAt, off uint64) (ret FreeRecord, err error) {
+	c, err := openChunk(r, off)
+	if err != nil {
+		return
+	}
+	defer c.release()
+
+	if c.h.Tag != "FREE" {
+		return ret, corrupt(c.h, "expected FREE record")
+	}
+	return c.free()
+}
+
+// ReadFree reads FreeRecord described by h
+func ReadFree(r io.ReaderAt, h RecordHeader) (ret FreeRecord, err error) {
+	c, err := readChunk(r, h)
+	if err != nil {
+		return
+	}
+	defer c.release()
+	return c.free()
+}
+
+// NewFree creates FreeRecord occupies length bytes, header included
+func NewFree(length uint32, next uint64) (ret FreeRecord) {
+	ret.Header = RecordHeader{Length: length, Tag: "FREE"}
+	ret.Next = next
+	return
+}
+
+// Save record to file, content of free space is not written
+func (n FreeRecord) Save(f io.Writer) (err error) {
+	err = n.Header.Save(f)
+	err = w(f, n.Next, err)
+	return
+}
+
+// ByteLength returns how many bytes written by Save, header included, see Size
+// for space the record occupies
+func (f FreeRecord) ByteLength() int {
+	return f.Header.ByteLength() + 8
+}
+
+// Size returns how many bytes can be reclaimed, header included
+func (f FreeRecord) Size() uint64 {
+	return uint64(f.Header.Length)
+}
+
+// FreeList is free records in the chain, in the order of linking
+type FreeList []FreeRecord
+
+// Reclaimable returns how many bytes can be reclaimed from all free records
+func (l FreeList) Reclaimable() (ret uint64) {
+	for _, f := range l {
+		ret += f.Size()
+	}
+	return
+}
+
+// FreeChain walks through free record chain, starting from FREE child of root record g
+//
+// Loops in the chain, links pointing to other records and free records overlap
+// each other are reported as *CorruptError.
+func FreeChain(r io.ReaderAt, g GGGRecord) (ret FreeList, err error) {
+	nodes, err := g.Children(r)
+	if err != nil {
+		return
+	}
+
+	seen := map[uint64]bool{}
+	for _, n := range nodes {
+		if n.Tag != "FREE" {
+			continue
+		}
+
+		for off := n.Start(); off != 0; {
+			if seen[off] {
+				return ret, corrupt(ret[len(ret)-1].Header, "free list loops back to %d", off)
+			}
+			seen[off] = true
+
+			f, err := Free(r, off)
+			if err != nil {
+				return ret, err
+			}
+			ret = append(ret, f)
+			off = f.Next
+		}
+	}
+
+	err = ret.checkOverlap()
+	return
+}
+
+// checkOverlap ensures no two free records share same bytes
+func (l FreeList) checkOverlap() error {
+	sorted := make(FreeList, len(l))
+	copy(sorted, l)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Header.Start() < sorted[j].Header.Start()
+	})
+
+	for idx := 1; idx < len(sorted); idx++ {
+		prev, cur := sorted[idx-1].Header, sorted[idx].Header
+		if prev.Start()+uint64(prev.Length) > cur.Start() {
+			return corrupt(cur, "overlaps free record at %d", prev.Start())
+		}
+	}
+	return nil
+}
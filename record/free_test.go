@@ -0,0 +1,102 @@
+package record
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// withFrees appends unlinked free records of lengths to sample file, returns
+// the file and offsets of all its free records, the linked one first
+func withFrees(t *testing.T, lengths ...uint32) (data []byte, starts []uint64) {
+	data = sample(Version3)
+	g, err := GGG(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	starts = []uint64{g.Offsets[1]}
+
+	buf := bytes.NewBuffer(data)
+	for _, l := range lengths {
+		starts = append(starts, uint64(buf.Len()))
+		if err = NewFree(l, 0).Save(buf); err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(make([]byte, l-16))
+	}
+	return buf.Bytes(), starts
+}
+
+// link makes free record at from point to offset to
+func link(data []byte, from, to uint64) {
+	binary.LittleEndian.PutUint64(data[from+8:], to)
+}
+
+// chain reads free chain of data
+func chain(t *testing.T, data []byte) (FreeList, error) {
+	r := bytes.NewReader(data)
+	g, err := GGG(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FreeChain(r, g)
+}
+
+func TestFreeChain(t *testing.T) {
+	data, starts := withFrees(t, 24, 16)
+	link(data, starts[0], starts[1])
+	link(data, starts[1], starts[2])
+
+	l, err := chain(t, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l) != 3 {
+		t.Fatalf("expected 3 free records, got %d", len(l))
+	}
+	for k, f := range l {
+		if f.Header.Start() != starts[k] {
+			t.Errorf("free record %d starts at %d, expected %d", k, f.Header.Start(), starts[k])
+		}
+	}
+	if n := l.Reclaimable(); n != 20+24+16 {
+		t.Errorf("expected %d bytes reclaimable, got %d", 20+24+16, n)
+	}
+}
+
+func TestFreeChainCorrupt(t *testing.T) {
+	g, err := GGG(bytes.NewReader(sample(Version3)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]func([]byte, []uint64){
+		"loops back": func(data []byte, starts []uint64) {
+			link(data, starts[0], starts[1])
+			link(data, starts[1], starts[0])
+		},
+		"expected FREE": func(data []byte, starts []uint64) {
+			link(data, starts[0], starts[1])
+			link(data, starts[1], g.Offsets[0])
+		},
+		// another free record lives inside the space of second one
+		"overlaps": func(data []byte, starts []uint64) {
+			inner, buf := starts[1]+16, &bytes.Buffer{}
+			NewFree(16, 0).Save(buf)
+			copy(data[inner:], buf.Bytes())
+			link(data, starts[0], starts[1])
+			link(data, starts[1], inner)
+		},
+	}
+	for reason, corrupt := range cases {
+		data, starts := withFrees(t, 40)
+		corrupt(data, starts)
+		_, err := chain(t, data)
+		var c *CorruptError
+		if !errors.As(err, &c) || !strings.Contains(c.Reason, reason) {
+			t.Errorf("expected CorruptError saying %q, got %v", reason, err)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// sample builds a tiny ggpk file: GGPK header, root directory containing a
+// file and a free record, and the file itself
+func sample(v Version) []byte {
+	digest := make([]byte, 32)
+	g := NewGGG(v)
+
+	file := NewFile("中文𝄞.txt", digest, v)
+	fileHeader := RecordHeader{Tag: "FILE", Length: uint32(8 + file.ByteLength() + 5)}
+	free := NewFree(16+4, 0)
+
+	root := NewDirectory("", digest, []DirectoryEntry{{Hash: v.Hash(file.Name)}}, v)
+	rootHeader := RecordHeader{Tag: "PDIR", Length: uint32(8 + root.ByteLength())}
+
+	g.Offsets[0] = uint64(g.ByteLength())
+	root.Entries[0].Offset = g.Offsets[0] + uint64(rootHeader.Length)
+	g.Offsets[1] = root.Entries[0].Offset + uint64(fileHeader.Length)
+
+	buf := &bytes.Buffer{}
+	for _, s := range []Saver{g, rootHeader, root, fileHeader, file} {
+		if err := s.Save(buf); err != nil {
+			panic(err)
+		}
+	}
+	buf.WriteString("hello")
+	err := free.Save(buf)
+	buf.WriteString("junk")
+	if err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+// seed adds sample files of every version, with offsets of all records in them
+func seed(f *testing.F) {
+	for _, v := range []Version{Version2, Version3, Version4} {
+		data := sample(v)
+		g, err := GGG(bytes.NewReader(data))
+		if err != nil {
+			f.Fatal(err)
+		}
+		dir, err := Directory(bytes.NewReader(data), g.Offsets[0], v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		for _, off := range []uint64{0, g.Offsets[0], dir.Entries[0].Offset, g.Offsets[1], 3} {
+			f.Add(data, uint32(off), uint32(v))
+		}
+	}
+}
+
+// expectCorrupt fails the test if err is neither nil nor *CorruptError
+func expectCorrupt(t *testing.T, err error) {
+	var c *CorruptError
+	if err != nil && !errors.As(err, &c) {
+		t.Fatalf("unexpected error type %T: %v", err, err)
+	}
+}
+
+// fitFile fails the test if record h exceeds data
+func fitFile(t *testing.T, h RecordHeader, data []byte) {
+	if h.Start()+uint64(h.Length) > uint64(len(data)) {
+		t.Fatalf("record at %d (%d bytes) exceeds end of file (%d bytes)", h.Start(), h.Length, len(data))
+	}
+}
+
+func FuzzHeader(f *testing.F) {
+	seed(f)
+	f.Fuzz(func(t *testing.T, data []byte, off uint32, _ uint32) {
+		h, err := Header(bytes.NewReader(data), uint64(off))
+		expectCorrupt(t, err)
+		if err != nil {
+			return
+		}
+		if h.Start() != uint64(off) {
+			t.Fatalf("record starts at %d, expected %d", h.Start(), off)
+		}
+		fitFile(t, h, data)
+	})
+}
+
+func FuzzGGG(f *testing.F) {
+	seed(f)
+	f.Fuzz(func(t *testing.T, data []byte, _ uint32, _ uint32) {
+		r := bytes.NewReader(data)
+		g, err := GGG(r)
+		expectCorrupt(t, err)
+		if err != nil {
+			return
+		}
+		for _, off := range g.Offsets {
+			if off >= uint64(len(data)) {
+				t.Fatalf("child offset %d exceeds end of file", off)
+			}
+		}
+		_, err = g.Children(r)
+		expectCorrupt(t, err)
+		_, err = FreeChain(r, g)
+		expectCorrupt(t, err)
+	})
+}
+
+func FuzzFile(f *testing.F) {
+	seed(f)
+	f.Fuzz(func(t *testing.T, data []byte, off uint32, v uint32) {
+		file, err := File(bytes.NewReader(data), uint64(off), Version(v))
+		expectCorrupt(t, err)
+		if err != nil {
+			return
+		}
+		if len(file.Digest) != 32 {
+			t.Fatalf("digest is %d bytes", len(file.Digest))
+		}
+	})
+}
+
+func FuzzDirectory(f *testing.F) {
+	seed(f)
+	f.Fuzz(func(t *testing.T, data []byte, off uint32, v uint32) {
+		r := bytes.NewReader(data)
+		dir, err := Directory(r, uint64(off), Version(v))
+		expectCorrupt(t, err)
+		if err != nil {
+			return
+		}
+		if int(dir.ChildCount) != len(dir.Entries) {
+			t.Fatalf("%d entries, but child count is %d", len(dir.Entries), dir.ChildCount)
+		}
+		if len(dir.Digest) != 32 {
+			t.Fatalf("digest is %d bytes", len(dir.Digest))
+		}
+		_, err = dir.Children(r)
+		expectCorrupt(t, err)
+		_, _, err = dir.Find(r, "中文𝄞.TXT")
+		if !errors.Is(err, ErrNotFound) {
+			expectCorrupt(t, err)
+		}
+	})
+}
+
+func FuzzFree(f *testing.F) {
+	seed(f)
+	f.Fuzz(func(t *testing.T, data []byte, off uint32, _ uint32) {
+		free, err := Free(bytes.NewReader(data), uint64(off))
+		expectCorrupt(t, err)
+		if err != nil {
+			return
+		}
+		fitFile(t, free.Header, data)
+	})
+}
+
+func FuzzDecode(f *testing.F) {
+	seed(f)
+	f.Fuzz(func(t *testing.T, data []byte, off uint32, v uint32) {
+		r := bytes.NewReader(data)
+		h, rec, err := Decode(r, uint64(off), Version(v))
+		expectCorrupt(t, err)
+		if err != nil {
+			return
+		}
+		fitFile(t, h, data)
+
+		switch rec.(type) {
+		case FileRecord, DirectoryRecord, FreeRecord, RawRecord:
+		default:
+			t.Fatalf("unexpected record type %T", rec)
+		}
+		if _, err = ReadRaw(r, h); err != nil {
+			t.Fatalf("cannot read raw data of a valid record: %v", err)
+		}
+	})
+}
+
+func FuzzScanner(f *testing.F) {
+	seed(f)
+	f.Fuzz(func(t *testing.T, data []byte, off uint32, _ uint32) {
+		r := bytes.NewReader(data)
+		s := NewScanner(r, int64(len(data)))
+		if off > 0 {
+			s.Seek(uint64(off))
+		}
+
+		last := int64(-1)
+		for s.Scan() {
+			h := s.Header()
+			if int64(h.Start()) <= last {
+				t.Fatalf("scanner goes backward from %d to %d", last, h.Start())
+			}
+			last = int64(h.Start())
+			fitFile(t, h, data)
+		}
+		expectCorrupt(t, s.Err())
+	})
+}
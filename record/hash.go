@@ -0,0 +1,141 @@
+package record
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned by DirectoryRecord.Find if no entry has the name
+var ErrNotFound = errors.New("record: entry not found")
+
+// murmur2 computes 32-bit MurmurHash2 of data
+func murmur2(data []byte, seed uint32) uint32 {
+	const (
+		m = 0x5bd1e995
+		r = 24
+	)
+
+	h := seed ^ uint32(len(data))
+	for ; len(data) >= 4; data = data[4:] {
+		k := binary.LittleEndian.Uint32(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	switch len(data) {
+	case 3:
+		h ^= uint32(data[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(data[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(data[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return h
+}
+
+// Hash computes name hash stored in DirectoryEntry, which is MurmurHash2 of
+// lowercased name encoded as stored in ggpk file, without tailing null
+func (v Version) Hash(name string) uint32 {
+	data := v.EncodeName(strings.ToLower(name))
+	return murmur2(data[:len(data)-v.CharSize()], 0)
+}
+
+// Sorted reports whether entries are sorted by name hash, as the game does
+func (d DirectoryRecord) Sorted() bool {
+	return sort.SliceIsSorted(d.Entries, func(i, j int) bool {
+		return d.Entries[i].Hash < d.Entries[j].Hash
+	})
+}
+
+// Find reads the child record named name, rec is FileRecord or DirectoryRecord
+//
+// Entries are binary searched by name hash if they are sorted, only records
+// with matching hash are decoded. If entries are not sorted and no hash
+// matches, which is the case of ggpk files written by older version of defrag,
+// every child record is decoded and compared.
+func (d DirectoryRecord) Find(r io.ReaderAt, name string) (h RecordHeader, rec interface{}, err error) {
+	hs, recs, err := d.search(r, name, func(n string) bool { return n == name }, true)
+	if err != nil {
+		return
+	}
+	if len(recs) == 0 {
+		return h, nil, ErrNotFound
+	}
+	return hs[0], recs[0], nil
+}
+
+// FindFold reads child records whose name equals name case-insensitively,
+// like the game does, recs are FileRecord or DirectoryRecord
+//
+// Names are compared in lower case, as name hash is computed, so only records
+// with matching hash are decoded, see Find. Empty result is not an error.
+func (d DirectoryRecord) FindFold(r io.ReaderAt, name string) (hs []RecordHeader, recs []interface{}, err error) {
+	lower := strings.ToLower(name)
+	return d.search(r, name, func(n string) bool { return strings.ToLower(n) == lower }, false)
+}
+
+// search decodes children named name, by name hash, and returns those match
+// reports true, only the first one if first is set
+func (d DirectoryRecord) search(r io.ReaderAt, name string, match func(string) bool, first bool) (hs []RecordHeader, recs []interface{}, err error) {
+	hash := d.Version.Hash(name)
+	sorted := d.Sorted()
+
+	candidates := d.Entries
+	if sorted {
+		start := sort.Search(len(d.Entries), func(i int) bool { return d.Entries[i].Hash >= hash })
+		end := start
+		for end < len(d.Entries) && d.Entries[end].Hash == hash {
+			end++
+		}
+		candidates = d.Entries[start:end]
+	}
+
+	var todo []DirectoryEntry
+	for _, e := range candidates {
+		if e.Hash == hash {
+			todo = append(todo, e)
+		}
+	}
+	if !sorted && len(todo) == 0 {
+		todo = d.Entries
+	}
+
+	for _, e := range todo {
+		h, rec, err := Decode(r, e.Offset, d.Version)
+		if err != nil {
+			return hs, recs, err
+		}
+		if n, ok := recordName(rec); ok && match(n) {
+			hs = append(hs, h)
+			recs = append(recs, rec)
+			if first {
+				break
+			}
+		}
+	}
+	return
+}
+
+// recordName returns name of FileRecord or DirectoryRecord
+func recordName(rec interface{}) (string, bool) {
+	switch x := rec.(type) {
+	case FileRecord:
+		return x.Name, true
+	case DirectoryRecord:
+		return x.Name, true
+	}
+	return "", false
+}
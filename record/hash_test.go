@@ -0,0 +1,37 @@
+package record
+
+import "testing"
+
+// expected values are computed by reference implementation of MurmurHash2
+func TestMurmur2(t *testing.T) {
+	cases := map[string]uint32{
+		"":      0,
+		"hello": 0xe56129cb,
+		"The quick brown fox jumps over the lazy dog": 0x212729d0,
+	}
+	for data, want := range cases {
+		if got := murmur2([]byte(data), 0); got != want {
+			t.Errorf("hash of %q is %08x, expected %08x", data, got, want)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	cases := []struct {
+		name   string
+		v3, v4 uint32
+	}{
+		{"Data", 0x630ee610, 0x1ae1869f},
+		{"DATA", 0x630ee610, 0x1ae1869f},
+		{"Mods.dat", 0x88b95147, 0x43282edb},
+		{"中文𝄞.txt", 0xd56c650e, 0xf7f89c22},
+	}
+	for _, c := range cases {
+		if h := Version3.Hash(c.name); h != c.v3 {
+			t.Errorf("v3 hash of %q is %08x, expected %08x", c.name, h, c.v3)
+		}
+		if h := Version4.Hash(c.name); h != c.v4 {
+			t.Errorf("v4 hash of %q is %08x, expected %08x", c.name, h, c.v4)
+		}
+	}
+}
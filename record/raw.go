@@ -0,0 +1,31 @@
+package record
+
+import "io"
+
+// RawRecord is a record kept as is, used to carry records of unknown type
+type RawRecord struct {
+	Header RecordHeader
+	Data   []byte // everything after header
+}
+
+// ReadRaw reads whole data of record described by h
+func ReadRaw(r io.ReaderAt, h RecordHeader) (ret RawRecord, err error) {
+	c, err := readChunk(r, h)
+	if err != nil {
+		return
+	}
+	defer c.release()
+	return c.raw()
+}
+
+// Save record to ggpk file, header included
+func (r RawRecord) Save(f io.Writer) (err error) {
+	err = r.Header.Save(f)
+	err = w(f, r.Data, err)
+	return
+}
+
+// ByteLength returns how many bytes occupied in ggpk file, header included
+func (r RawRecord) ByteLength() int {
+	return r.Header.ByteLength() + len(r.Data)
+}
@@ -0,0 +1,94 @@
+package record
+
+import "io"
+
+// Scanner walks through every record in ggpk file linearly, from the record
+// right after GGPK header to end of file, no matter the record is reachable
+// from root directory or not.
+//
+// Scanning stops at first error, which is usually *CorruptError when a record
+// is misaligned or exceeds end of file.
+type Scanner struct {
+	r       io.ReaderAt
+	size    uint64
+	next    uint64 // offset of next record
+	cur     RecordHeader
+	err     error
+	started bool
+}
+
+// NewScanner creates Scanner which reads records from r, which is size bytes long
+func NewScanner(r io.ReaderAt, size int64) *Scanner {
+	return &Scanner{r: io.NewSectionReader(r, 0, size), size: uint64(size)}
+}
+
+// Seek makes next Scan read record starting at offset off
+func (s *Scanner) Seek(off uint64) {
+	s.next = off
+	s.started = true
+	s.err = nil
+}
+
+// Scan advances to next record, returns false when reaching end of file or an error occurs
+func (s *Scanner) Scan() bool {
+	if s.err != nil {
+		return false
+	}
+
+	if !s.started {
+		s.started = true
+		g, err := GGG(s.r)
+		if err != nil {
+			s.err = err
+			return false
+		}
+		s.next = uint64(g.Header.Length)
+	}
+
+	if s.next >= s.size {
+		return false
+	}
+
+	h, err := Header(s.r, s.next)
+	if err != nil {
+		s.err = err
+		return false
+	}
+	if !validTag(h.Tag) {
+		s.err = corrupt(h, "record is misaligned, tag is not ascii text")
+		return false
+	}
+
+	s.cur = h
+	s.next += uint64(h.Length)
+	return true
+}
+
+// Header returns header of current record, use Header().Start() to get its offset
+func (s *Scanner) Header() RecordHeader {
+	return s.cur
+}
+
+// Err returns the error stopped scanning, or nil if end of file is reached
+func (s *Scanner) Err() error {
+	return s.err
+}
+
+// Known reports whether tag is one of GGPK, PDIR, FILE or FREE
+func Known(tag string) bool {
+	switch tag {
+	case "GGPK", "PDIR", "FILE", "FREE":
+		return true
+	}
+	return false
+}
+
+// validTag reports whether tag looks like a record tag: printable ascii characters
+func validTag(tag string) bool {
+	for _, c := range []byte(tag) {
+		if c < 0x20 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,65 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// scan returns tags and offsets of every record in data
+func scan(data []byte) (tags []string, starts []uint64, err error) {
+	s := NewScanner(bytes.NewReader(data), int64(len(data)))
+	for s.Scan() {
+		tags = append(tags, s.Header().Tag)
+		starts = append(starts, s.Header().Start())
+	}
+	return tags, starts, s.Err()
+}
+
+func TestScanner(t *testing.T) {
+	for _, v := range []Version{Version3, Version4} {
+		data := sample(v)
+		g, err := GGG(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// orphan record is not linked from anywhere
+		orphan := uint64(len(data))
+		data = append(data, saveRecord(t, "FILE", NewFile("orphan.txt", make([]byte, 32), v))...)
+
+		tags, starts, err := scan(data)
+		if err != nil {
+			t.Fatalf("v%d: %v", v, err)
+		}
+		if got := strings.Join(tags, ","); got != "PDIR,FILE,FREE,FILE" {
+			t.Fatalf("v%d: scanned %s", v, got)
+		}
+		if starts[0] != g.Offsets[0] || starts[2] != g.Offsets[1] || starts[3] != orphan {
+			t.Errorf("v%d: records start at %v", v, starts)
+		}
+	}
+}
+
+func TestScannerCorrupt(t *testing.T) {
+	cases := map[string][]byte{
+		"misaligned":          {16, 0, 0, 0, 'A', 0, 0xff, 'D', 0, 0, 0, 0, 0, 0, 0, 0},
+		"exceeds end of file": append([]byte{100, 0, 0, 0, 'F', 'I', 'L', 'E'}, make([]byte, 20)...),
+	}
+	for reason, tail := range cases {
+		data := append(sample(Version3), tail...)
+		tags, starts, err := scan(data)
+		var corrupt *CorruptError
+		if !errors.As(err, &corrupt) || !strings.Contains(corrupt.Reason, reason) {
+			t.Errorf("expected CorruptError saying %q, got %v", reason, err)
+			continue
+		}
+		if corrupt.Offset != uint64(len(data)-len(tail)) {
+			t.Errorf("%s: error is reported at %d, expected %d", reason, corrupt.Offset, len(data)-len(tail))
+		}
+		if len(tags) != 3 || starts[2]+20 != uint64(len(data)-len(tail)) {
+			t.Errorf("%s: records before corrupted one are %v at %v", reason, tags, starts)
+		}
+	}
+}
@@ -1,21 +1,17 @@
 package record
 
-import "os"
+import "io"
 
-// ReadDir record from file
-func ReadDir(f *os.File, h RecordHeader) (ret DirectoryRecord, err error) {
-	if _, err = f.Seek(int64(h.Offset), 0); err != nil {
-		return
-	}
-	ret, err = Directory(f)
-	return
+// Saver is a record which can be saved to ggpk file
+//
+// ByteLength is how many bytes Save writes. Records holding their own header,
+// like GGGRecord, FreeRecord and RawRecord, write the header too.
+type Saver interface {
+	Save(w io.Writer) error
+	ByteLength() int
 }
 
-// ReadFile record from file
-func ReadFile(f *os.File, h RecordHeader) (ret FileRecord, err error) {
-	if _, err = f.Seek(int64(h.Offset), 0); err != nil {
-		return
-	}
-	ret, err = File(f)
-	return
+// SaveAt saves record s to w at offset off, without touching any shared file offset
+func SaveAt(w io.WriterAt, off int64, s Saver) error {
+	return s.Save(io.NewOffsetWriter(w, off))
 }
@@ -3,11 +3,16 @@ package record
 
 import (
 	"encoding/binary"
-	"os"
-	"unicode/utf16"
+	"errors"
+	"fmt"
+	"io"
+	"math"
 )
 
-func w(f *os.File, data interface{}, err error) (e error) {
+// ErrInconsistent is wrapped by errors returned from Validate
+var ErrInconsistent = errors.New("record: inconsistent record")
+
+func w(f io.Writer, data interface{}, err error) (e error) {
 	e = err
 	if e == nil {
 		e = binary.Write(f, binary.LittleEndian, data)
@@ -22,24 +27,73 @@ type RecordHeader struct {
 	Offset uint64 // file offset of data
 }
 
-// Header reads header from stream
-func Header(r *os.File) (ret RecordHeader, err error) {
-	var l uint32
-	if err = binary.Read(r, binary.LittleEndian, &l); err != nil {
+// Header reads header of the record starting at offset off
+//
+// Length of the record is validated against size of r, if it can be determined.
+func Header(r io.ReaderAt, off uint64) (ret RecordHeader, err error) {
+	buf := make([]byte, ret.ByteLength())
+	if off > math.MaxInt64 {
+		return parseHeader(r, off, nil)
+	}
+	n, err := r.ReadAt(buf, int64(off))
+	if n == len(buf) || err == io.EOF {
+		err = nil
+	}
+	if err != nil {
 		return
 	}
+	return parseHeader(r, off, buf[:n])
+}
 
-	t := make([]byte, 4)
-	if err = binary.Read(r, binary.LittleEndian, t); err != nil {
-		return
+// parseHeader decodes header of the record starting at offset off from buf
+func parseHeader(r io.ReaderAt, off uint64, buf []byte) (ret RecordHeader, err error) {
+	ret.Offset = off + uint64(ret.ByteLength())
+	if len(buf) < ret.ByteLength() {
+		return ret, corrupt(ret, "header exceeds end of file")
 	}
 
-	ret = RecordHeader{l, string(t), 0}
+	ret.Length = binary.LittleEndian.Uint32(buf)
+	ret.Tag = string(buf[4:ret.ByteLength()])
+	if int(ret.Length) < ret.ByteLength() {
+		return ret, corrupt(ret, "length %d is shorter than header", ret.Length)
+	}
+	if size := Size(r); size >= 0 && off+uint64(ret.Length) > uint64(size) {
+		return ret, corrupt(ret, "length %d exceeds end of file (%d bytes)", ret.Length, size)
+	}
 	return
 }
 
+// expect reads header at offset off, and ensures it has specified tag
+func expect(r io.ReaderAt, off uint64, tag string) (ret RecordHeader, err error) {
+	if ret, err = Header(r, off); err != nil {
+		return
+	}
+	if ret.Tag != tag {
+		err = corrupt(ret, "expected %s record", tag)
+	}
+	return
+}
+
+// Start returns file offset of the record, header included
+func (h RecordHeader) Start() uint64 {
+	return h.Offset - uint64(h.ByteLength())
+}
+
+// body returns a reader which reads data of record h, and nothing beyond it
+func body(r io.ReaderAt, h RecordHeader) *io.SectionReader {
+	return io.NewSectionReader(r, int64(h.Offset), int64(h.Length)-int64(h.ByteLength()))
+}
+
+// fit ensures record h is long enough to contain n bytes of data
+func fit(h RecordHeader, n uint64) error {
+	if avail := uint64(h.Length) - uint64(h.ByteLength()); n > avail {
+		return corrupt(h, "needs %d bytes of data, only %d available", n, avail)
+	}
+	return nil
+}
+
 // Save saves header to ggpk
-func (h RecordHeader) Save(f *os.File) (err error) {
+func (h RecordHeader) Save(f io.Writer) (err error) {
 	err = w(f, h.Length, err)
 	data := []byte(h.Tag)
 	err = w(f, data, err)
@@ -53,54 +107,85 @@ func (h RecordHeader) ByteLength() int {
 
 // GGGRecord is root record
 type GGGRecord struct {
-	Header    RecordHeader
-	NodeCount uint32   // how many
-	Offsets   []uint64 // file position of child node
+	Header  RecordHeader
+	Version Version
+	Offsets [2]uint64 // file position of root directory and first free record
 }
 
-// GGG reads GGGRecord from stream
-func GGG(r *os.File) (ret GGGRecord, err error) {
-	if ret.Header, err = Header(r); err != nil {
-		return
-	}
+// NewGGG creates root record of specified version, offsets are left empty
+func NewGGG(v Version) (ret GGGRecord) {
+	ret.Version = v
+	ret.Header.Tag = "GGPK"
+	ret.Header.Length = uint32(ret.ByteLength())
+	return
+}
 
-	var c uint32
-	if err = binary.Read(r, binary.LittleEndian, &c); err != nil {
+// GGG reads GGGRecord from the very beginning of r
+//
+// Version 1, written by older version of defrag, is read as Version3. Other
+// versions than Version2, Version3 and Version4 are rejected as corrupted.
+func GGG(r io.ReaderAt) (ret GGGRecord, err error) {
+	h, err := expect(r, 0, "GGPK")
+	if err != nil {
 		return
 	}
-	pos := make([]uint64, c)
-	if err = binary.Read(r, binary.LittleEndian, pos); err != nil {
+	ret.Header = h
+	if err = fit(h, 4+8); err != nil {
 		return
 	}
-	ret.NodeCount = c
-	ret.Offsets = pos
+
+	s := body(r, h)
+	if err = binary.Read(s, binary.LittleEndian, &ret.Version); err != nil {
+		return ret, truncated(h, err)
+	}
+	if ret.Version == versionOldDefrag {
+		ret.Version = Version3
+	}
+	if !ret.Version.Supported() {
+		return ret, corrupt(h, "unsupported version %d", ret.Version)
+	}
+
+	// ggpk files written by older version of defrag contain only one offset
+	c := (s.Size() - 4) / 8
+	if c > int64(len(ret.Offsets)) {
+		c = int64(len(ret.Offsets))
+	}
+	if err = binary.Read(s, binary.LittleEndian, ret.Offsets[:c]); err != nil {
+		return ret, truncated(h, err)
+	}
+
+	size := Size(r)
+	for _, off := range ret.Offsets {
+		if size >= 0 && off >= uint64(size) {
+			return ret, corrupt(h, "child offset %d exceeds end of file (%d bytes)", off, size)
+		}
+	}
 	return
 }
 
 // Save record to file
-func (g GGGRecord) Save(f *os.File) (err error) {
+func (g GGGRecord) Save(f io.Writer) (err error) {
 	err = g.Header.Save(f)
-	err = w(f, g.NodeCount, err)
+	err = w(f, g.Version, err)
 	err = w(f, g.Offsets, err)
 	return
 }
 
 // ByteLength returns how many bytes occupied in ggpk file
 func (g GGGRecord) ByteLength() int {
-	return g.Header.ByteLength() + 4 + int(g.NodeCount)*8
+	return g.Header.ByteLength() + 4 + len(g.Offsets)*8
 }
 
-// Children reads child node header from file
-func (g GGGRecord) Children(f *os.File) (ret []RecordHeader, err error) {
-	for i := uint32(0); i < g.NodeCount; i++ {
-		if _, err = f.Seek(int64(g.Offsets[i]), 0); err != nil {
-			return
+// Children reads child node header from file, empty offsets are skipped
+func (g GGGRecord) Children(r io.ReaderAt) (ret []RecordHeader, err error) {
+	for _, off := range g.Offsets {
+		if off == 0 {
+			continue
 		}
-		node, err := Header(f)
+		node, err := Header(r, off)
 		if err != nil {
 			return ret, err
 		}
-		node.Offset = g.Offsets[i] + uint64(node.ByteLength())
 		ret = append(ret, node)
 	}
 	return
@@ -108,18 +193,13 @@ func (g GGGRecord) Children(f *os.File) (ret []RecordHeader, err error) {
 
 // DirectoryEntry is an item in directory
 type DirectoryEntry struct {
-	Timestamp uint32
-	Offset    uint64
-}
-
-func readDirectoryEntry(r *os.File) (ret DirectoryEntry, err error) {
-	err = binary.Read(r, binary.LittleEndian, &ret)
-	return
+	Hash   uint32 // name hash of the child, see Version.Hash
+	Offset uint64
 }
 
 // Save directory entry to file
-func (d DirectoryEntry) Save(f *os.File) (err error) {
-	err = w(f, d.Timestamp, err)
+func (d DirectoryEntry) Save(f io.Writer) (err error) {
+	err = w(f, d.Hash, err)
 	err = w(f, d.Offset, err)
 	return
 }
@@ -133,45 +213,68 @@ func (d DirectoryEntry) ByteLength() int {
 type FileRecord struct {
 	NameLength uint32
 	Digest     []byte
-	Name       string // file name in utf16le, null ended
-	OrigFile   *os.File
+	Name       string // file name in utf16le (utf32le since version 4), null ended
+	Version    Version
+	OrigFile   io.ReaderAt
 }
 
-// File reads FileRecord from stream
-func File(r *os.File) (ret FileRecord, err error) {
-	var l uint32
-	if err = binary.Read(r, binary.LittleEndian, &l); err != nil {
+// File reads FileRecord which starts at offset off
+func File(r io.ReaderAt, off uint64, v Version) (ret FileRecord, err error) {
+	c, err := openChunk(r, off)
+	if err != nil {
 		return
 	}
+	defer c.release()
 
-	d := make([]byte, 32)
-	if err = binary.Read(r, binary.LittleEndian, &d); err != nil {
-		return
+	if c.h.Tag != "FILE" {
+		return ret, corrupt(c.h, "expected FILE record")
 	}
+	return c.file(v)
+}
 
-	name := make([]uint16, l)
-	if err = binary.Read(r, binary.LittleEndian, name); err != nil {
+// ReadFile reads FileRecord described by h
+func ReadFile(r io.ReaderAt, h RecordHeader, v Version) (ret FileRecord, err error) {
+	c, err := readChunk(r, h)
+	if err != nil {
 		return
 	}
-	utf8Name := utf16.Decode(name)
+	defer c.release()
+	return c.file(v)
+}
 
-	ret = FileRecord{l, d, string(utf8Name[:len(utf8Name)-1]), r}
-	return
+// NewFile creates FileRecord, NameLength is derived from name encoded as version v
+func NewFile(name string, digest []byte, v Version) FileRecord {
+	return FileRecord{
+		NameLength: v.NameLength(name),
+		Digest:     digest,
+		Name:       name,
+		Version:    v,
+	}
+}
+
+// Validate ensures fields of the record agree with each other, so it can be saved safely
+func (r FileRecord) Validate() error {
+	if l := r.Version.NameLength(r.Name); l != r.NameLength {
+		return fmt.Errorf("%w: name length of file %q is %d, should be %d", ErrInconsistent, r.Name, r.NameLength, l)
+	}
+	if len(r.Digest) != 32 {
+		return fmt.Errorf("%w: digest of file %q is %d bytes", ErrInconsistent, r.Name, len(r.Digest))
+	}
+	return nil
 }
 
-// Save file record to ggpk file
-func (r FileRecord) Save(f *os.File) (err error) {
-	name := utf16.Encode([]rune(r.Name))
-	name = append(name, 0)
+// Save file record to ggpk file, inconsistent record is rejected
+func (r FileRecord) Save(f io.Writer) (err error) {
+	err = r.Validate()
 	err = w(f, r.NameLength, err)
 	err = w(f, r.Digest, err)
-	err = w(f, name, err)
+	err = w(f, r.Version.EncodeName(r.Name), err)
 	return
 }
 
 // ByteLength returns how many bytes occupied in ggpk file
 func (f FileRecord) ByteLength() int {
-	return 4 + 32 + int(f.NameLength*2)
+	return 4 + 32 + int(f.NameLength)*f.Version.CharSize()
 }
 
 // DirectoryRecord is a directory
@@ -180,74 +283,83 @@ type DirectoryRecord struct {
 	ChildCount uint32
 	Digest     []byte
 	Name       string
+	Version    Version
 	Entries    []DirectoryEntry
 }
 
-// Directory reads DirectoryRecord from stream
-func Directory(r *os.File) (ret DirectoryRecord, err error) {
-	var l uint32
-	if err = binary.Read(r, binary.LittleEndian, &l); err != nil {
+// Directory reads DirectoryRecord which starts at offset off
+func Directory(r io.ReaderAt, off uint64, v Version) (ret DirectoryRecord, err error) {
+	c, err := openChunk(r, off)
+	if err != nil {
 		return
 	}
+	defer c.release()
 
-	var c uint32
-	if err = binary.Read(r, binary.LittleEndian, &c); err != nil {
-		return
+	if c.h.Tag != "PDIR" {
+		return ret, corrupt(c.h, "expected PDIR record")
 	}
+	return c.dir(v)
+}
 
-	d := make([]byte, 32)
-	if err = binary.Read(r, binary.LittleEndian, &d); err != nil {
+// ReadDir reads DirectoryRecord described by h
+func ReadDir(r io.ReaderAt, h RecordHeader, v Version) (ret DirectoryRecord, err error) {
+	c, err := readChunk(r, h)
+	if err != nil {
 		return
 	}
+	defer c.release()
+	return c.dir(v)
+}
 
-	n := make([]uint16, l)
-	if err = binary.Read(r, binary.LittleEndian, n); err != nil {
-		return
-	}
-	utf8Name := []rune(" ")
-	if len(n) != 1 || n[0] != 0 {
-		utf8Name = utf16.Decode(n)
+// NewDirectory creates DirectoryRecord, NameLength and ChildCount are derived from name and entries
+func NewDirectory(name string, digest []byte, entries []DirectoryEntry, v Version) DirectoryRecord {
+	return DirectoryRecord{
+		NameLength: v.NameLength(name),
+		ChildCount: uint32(len(entries)),
+		Digest:     digest,
+		Name:       name,
+		Version:    v,
+		Entries:    entries,
 	}
+}
 
-	child := make([]DirectoryEntry, c)
-	for i := uint32(0); i < c; i++ {
-		de, err := readDirectoryEntry(r)
-		if err != nil {
-			return ret, err
-		}
-		child[i] = de
+// Validate ensures fields of the record agree with each other, so it can be saved safely
+func (d DirectoryRecord) Validate() error {
+	if l := d.Version.NameLength(d.Name); l != d.NameLength {
+		return fmt.Errorf("%w: name length of directory %q is %d, should be %d", ErrInconsistent, d.Name, d.NameLength, l)
 	}
-
-	ret = DirectoryRecord{l, c, d, string(utf8Name[:len(utf8Name)-1]), child}
-	return
+	if int(d.ChildCount) != len(d.Entries) {
+		return fmt.Errorf("%w: directory %q has %d entries, but child count is %d", ErrInconsistent, d.Name, len(d.Entries), d.ChildCount)
+	}
+	if len(d.Digest) != 32 {
+		return fmt.Errorf("%w: digest of directory %q is %d bytes", ErrInconsistent, d.Name, len(d.Digest))
+	}
+	return nil
 }
 
-// Save directory record to ggpk file
-func (d DirectoryRecord) Save(f *os.File) (err error) {
-	name := utf16.Encode([]rune(d.Name))
-	name = append(name, 0)
+// Save directory record to ggpk file, inconsistent record is rejected
+func (d DirectoryRecord) Save(f io.Writer) (err error) {
+	err = d.Validate()
 	err = w(f, d.NameLength, err)
 	err = w(f, d.ChildCount, err)
 	err = w(f, d.Digest, err)
-	err = w(f, name, err)
+	err = w(f, d.Version.EncodeName(d.Name), err)
 	for _, n := range d.Entries {
-		if e := n.Save(f); e != nil {
-			err = e
+		if err != nil {
+			return
 		}
+		err = n.Save(f)
 	}
 	return
 }
 
-func (d DirectoryRecord) Children(f *os.File) (ret []RecordHeader, err error) {
+// Children reads header of every entry from file
+func (d DirectoryRecord) Children(r io.ReaderAt) (ret []RecordHeader, err error) {
 	for _, e := range d.Entries {
-		if _, err = f.Seek(int64(e.Offset), 0); err != nil {
-			return
-		}
-		h, err := Header(f)
+		h, err := Header(r, e.Offset)
 		if err != nil {
 			return ret, err
 		}
-		h.Offset = e.Offset + uint64(h.ByteLength())
 		ret = append(ret, h)
 	}
 	return
@@ -255,36 +367,9 @@ func (d DirectoryRecord) Children(f *os.File) (ret []RecordHeader, err error) {
 
 // ByteLength returns how many bytes occupied in ggpk file
 func (d DirectoryRecord) ByteLength() (ret int) {
-	ret = 4 + 4 + 32 + int(d.NameLength*2)
+	ret = 4 + 4 + 32 + int(d.NameLength)*d.Version.CharSize()
 	for _, e := range d.Entries {
 		ret += e.ByteLength()
 	}
 	return
 }
-
-// FreeRecord is free space
-type FreeRecord uint64
-
-// Free reads FreeRecord from stream
-func Free(r *os.File) (ret FreeRecord, err error) {
-	err = binary.Read(r, binary.LittleEndian, &ret)
-	return
-}
-
-func (n FreeRecord) Next(f *os.File) (ret FreeRecord, err error) {
-	if n == 0 {
-		return
-	}
-
-	if _, err = f.Seek(int64(n), 0); err != nil {
-		return
-	}
-
-	ret, err = Free(f)
-	return
-}
-
-// ByteLength returns how many bytes occupied in ggpk file
-func (f FreeRecord) ByteLength() int {
-	return 8
-}
@@ -0,0 +1,161 @@
+package record
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// names which need surrogate pairs in utf16
+var names = []string{"a.txt", "中文.txt", "𝄞😀.ogg", "Ünïcödé 𝄞/x"}
+
+// saveRecord saves s with header of tag, returns whole record
+func saveRecord(t testing.TB, tag string, s Saver) []byte {
+	buf := &bytes.Buffer{}
+	h := RecordHeader{Tag: tag, Length: uint32(8 + s.ByteLength())}
+	if err := h.Save(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != int(h.Length) {
+		t.Fatalf("%s record is %d bytes, but ByteLength says %d", tag, buf.Len(), h.Length)
+	}
+	return buf.Bytes()
+}
+
+func TestFileRoundTrip(t *testing.T) {
+	digest := bytes.Repeat([]byte{7}, 32)
+	for _, v := range []Version{Version3, Version4} {
+		for _, name := range names {
+			data := saveRecord(t, "FILE", NewFile(name, digest, v))
+			got, err := File(bytes.NewReader(data), 0, v)
+			if err != nil {
+				t.Fatalf("v%d %q: %v", v, name, err)
+			}
+			if got.Name != name || got.NameLength != v.NameLength(name) || !bytes.Equal(got.Digest, digest) {
+				t.Errorf("v%d: saved %q, got %q (length %d)", v, name, got.Name, got.NameLength)
+			}
+		}
+	}
+}
+
+func TestDirectoryRoundTrip(t *testing.T) {
+	digest := bytes.Repeat([]byte{9}, 32)
+	for _, v := range []Version{Version3, Version4} {
+		for _, name := range names {
+			entries := []DirectoryEntry{{Hash: v.Hash(name), Offset: 1234}, {Hash: 1, Offset: 5678}}
+			data := saveRecord(t, "PDIR", NewDirectory(name, digest, entries, v))
+			got, err := Directory(bytes.NewReader(data), 0, v)
+			if err != nil {
+				t.Fatalf("v%d %q: %v", v, name, err)
+			}
+			if got.Name != name || got.NameLength != v.NameLength(name) || !bytes.Equal(got.Digest, digest) {
+				t.Errorf("v%d: saved %q, got %q (length %d)", v, name, got.Name, got.NameLength)
+			}
+			if !reflect.DeepEqual(got.Entries, entries) {
+				t.Errorf("v%d %q: saved entries %v, got %v", v, name, entries, got.Entries)
+			}
+		}
+	}
+}
+
+func TestNameLength(t *testing.T) {
+	cases := []struct {
+		name   string
+		v3, v4 uint32
+	}{
+		{"a.txt", 6, 6},
+		{"中文.txt", 7, 7},
+		{"𝄞😀.ogg", 9, 7},
+	}
+	for _, c := range cases {
+		if l := Version3.NameLength(c.name); l != c.v3 {
+			t.Errorf("v3 length of %q is %d, expected %d", c.name, l, c.v3)
+		}
+		if l := Version4.NameLength(c.name); l != c.v4 {
+			t.Errorf("v4 length of %q is %d, expected %d", c.name, l, c.v4)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	digest := make([]byte, 32)
+	for _, v := range []Version{Version3, Version4} {
+		file := NewFile("𝄞.ogg", digest, v)
+		dir := NewDirectory("𝄞", digest, []DirectoryEntry{{1, 2}, {3, 4}}, v)
+		if err := file.Validate(); err != nil {
+			t.Errorf("v%d: %v", v, err)
+		}
+		if err := dir.Validate(); err != nil {
+			t.Errorf("v%d: %v", v, err)
+		}
+
+		// length counted in runes is wrong for v3, and in utf16 units for v4
+		file.NameLength = uint32(len([]rune(file.Name))) + 1
+		dir.NameLength = uint32(len([]rune(dir.Name))) + 1
+		if v == Version4 {
+			file.NameLength, dir.NameLength = 4, 3
+		}
+		if err := file.Validate(); !errors.Is(err, ErrInconsistent) {
+			t.Errorf("v%d: bad name length of file is accepted: %v", v, err)
+		}
+		if err := dir.Validate(); !errors.Is(err, ErrInconsistent) {
+			t.Errorf("v%d: bad name length of directory is accepted: %v", v, err)
+		}
+		buf := &bytes.Buffer{}
+		if err := file.Save(buf); !errors.Is(err, ErrInconsistent) || buf.Len() != 0 {
+			t.Errorf("v%d: file with bad name length is saved, %d bytes: %v", v, buf.Len(), err)
+		}
+		if err := dir.Save(buf); !errors.Is(err, ErrInconsistent) || buf.Len() != 0 {
+			t.Errorf("v%d: directory with bad name length is saved, %d bytes: %v", v, buf.Len(), err)
+		}
+	}
+}
+
+func TestSaverLength(t *testing.T) {
+	savers := map[string]Saver{
+		"GGPK": NewGGG(Version3),
+		"FREE": NewFree(100, 1234),
+		"RAW":  RawRecord{RecordHeader{Length: 13, Tag: "ABCD"}, []byte("hello")},
+	}
+	for tag, s := range savers {
+		buf := &bytes.Buffer{}
+		if err := s.Save(buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.Len() != s.ByteLength() {
+			t.Errorf("%s record: %d bytes written, but ByteLength says %d", tag, buf.Len(), s.ByteLength())
+		}
+	}
+}
+
+func TestGGGVersion(t *testing.T) {
+	for stored, want := range map[Version]Version{1: Version3, 2: Version2, 3: Version3, 4: Version4} {
+		g := NewGGG(stored)
+		buf := &bytes.Buffer{}
+		if err := g.Save(buf); err != nil {
+			t.Fatal(err)
+		}
+		got, err := GGG(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatalf("version %d: %v", stored, err)
+		}
+		if got.Version != want {
+			t.Errorf("version %d is read as %d, expected %d", stored, got.Version, want)
+		}
+	}
+
+	for _, v := range []Version{0, 5, 0x10000} {
+		buf := &bytes.Buffer{}
+		if err := NewGGG(v).Save(buf); err != nil {
+			t.Fatal(err)
+		}
+		var corrupt *CorruptError
+		if _, err := GGG(bytes.NewReader(buf.Bytes())); !errors.As(err, &corrupt) {
+			t.Errorf("version %d: expected CorruptError, got %v", v, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package record
+
+import (
+	"encoding/binary"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Version is format version of ggpk file, stored in GGGRecord
+type Version uint32
+
+// known ggpk versions
+const (
+	Version2 Version = 2
+	Version3 Version = 3
+	Version4 Version = 4 // Path of Exile 2, names are stored in utf32le
+)
+
+// versionOldDefrag is written by older version of defrag, which wrote count
+// of root offsets where version is stored, the content is same as Version3
+const versionOldDefrag Version = 1
+
+// Supported reports whether v is one of Version2, Version3 and Version4
+func (v Version) Supported() bool {
+	return v >= Version2 && v <= Version4
+}
+
+// CharSize returns how many bytes a character of name occupies
+func (v Version) CharSize() int {
+	if v >= Version4 {
+		return 4
+	}
+	return 2
+}
+
+// NameLength returns how many characters name occupies in ggpk file, including tailing null
+func (v Version) NameLength(name string) uint32 {
+	if v.CharSize() == 4 {
+		return uint32(utf8.RuneCountInString(name) + 1)
+	}
+	return uint32(len(utf16.Encode([]rune(name))) + 1)
+}
+
+// EncodeName converts name to bytes stored in ggpk file, null ended
+func (v Version) EncodeName(name string) []byte {
+	if v.CharSize() == 4 {
+		ret := make([]byte, 0, v.NameLength(name)*4)
+		for _, r := range name {
+			ret = binary.LittleEndian.AppendUint32(ret, uint32(r))
+		}
+		return binary.LittleEndian.AppendUint32(ret, 0)
+	}
+
+	units := utf16.Encode([]rune(name))
+	ret := make([]byte, 0, (len(units)+1)*2)
+	for _, u := range units {
+		ret = binary.LittleEndian.AppendUint16(ret, u)
+	}
+	return binary.LittleEndian.AppendUint16(ret, 0)
+}
+
+// DecodeName converts bytes stored in ggpk file to string, trailing null is removed
+func (v Version) DecodeName(data []byte) string {
+	var runes []rune
+	if v.CharSize() == 4 {
+		runes = make([]rune, len(data)/4)
+		for idx := range runes {
+			runes[idx] = rune(binary.LittleEndian.Uint32(data[idx*4:]))
+		}
+	} else {
+		units := make([]uint16, len(data)/2)
+		for idx := range units {
+			units[idx] = binary.LittleEndian.Uint16(data[idx*2:])
+		}
+		runes = utf16.Decode(units)
+	}
+
+	if l := len(runes); l > 0 && runes[l-1] == 0 {
+		runes = runes[:l-1]
+	}
+	return string(runes)
+}